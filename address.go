@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultPort = "25565"
+
+var errMissingAddress = errors.New("missing data")
+
+// parseAddress normalises a server address given as host, host:port,
+// [v6] or [v6]:port into host:port form, adding the default port if one
+// was not included.
+func parseAddress(address string) (string, error) {
+	address = strings.ToLower(strings.TrimSpace(address))
+	if address == "" {
+		return "", errMissingAddress
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		// Without a port, the address is either a hostname, an IPv4
+		// address, or an IPv6 address with or without brackets.
+		host, port = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]"), defaultPort
+	}
+
+	if host == "" {
+		return "", errMissingAddress
+	}
+
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+		return "", errors.New(errInvalidAddress)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+// requestAddress finds the requested server address. In order, it uses the
+// address path parameter, the address query parameter, or the ip and port
+// query parameters. An ip already containing a port is used as is.
+func requestAddress(c *gin.Context) (string, error) {
+	c.Request.ParseForm()
+
+	if address := c.Param("address"); address != "" {
+		return parseAddress(strings.TrimSuffix(address, ".png"))
+	}
+
+	if address := c.Request.Form.Get("address"); address != "" {
+		return parseAddress(address)
+	}
+
+	ip := c.Request.Form.Get("ip")
+	port := c.Request.Form.Get("port")
+
+	if port == "" {
+		return parseAddress(ip)
+	}
+
+	if _, _, err := net.SplitHostPort(ip); err == nil {
+		return parseAddress(ip)
+	}
+
+	return parseAddress(net.JoinHostPort(strings.Trim(ip, "[]"), port))
+}
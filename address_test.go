@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+		err     bool
+	}{
+		{"Example.com", "example.com:25565", false},
+		{" example.com:25566 ", "example.com:25566", false},
+		{"127.0.0.1", "127.0.0.1:25565", false},
+		{"::1", "[::1]:25565", false},
+		{"[::1]", "[::1]:25565", false},
+		{"[::1]:25566", "[::1]:25566", false},
+		{"", "", true},
+		{":25565", "", true},
+		{"example.com:0", "", true},
+		{"example.com:65536", "", true},
+		{"example.com:port", "", true},
+	}
+
+	for _, test := range tests {
+		got, err := parseAddress(test.address)
+		if (err != nil) != test.err || got != test.want {
+			t.Errorf("parseAddress(%q) = %q, %v; want %q", test.address, got, err, test.want)
+		}
+	}
+}
+
+func TestRequestAddress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	handler := func(c *gin.Context) {
+		address, err := requestAddress(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		c.String(http.StatusOK, address)
+	}
+	router.GET("/address", handler)
+	router.GET("/address/:address", handler)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/address/example.com", "example.com:25565"},
+		{"/address/example.com:25566.png", "example.com:25566"},
+		{"/address?address=example.com:25566&ip=other.example.com", "example.com:25566"},
+		{"/address?ip=example.com&port=25566", "example.com:25566"},
+		{"/address?ip=example.com:25567&port=25566", "example.com:25567"},
+		{"/address?ip=::1&port=25566", "[::1]:25566"},
+		{"/address?ip=[::1]&port=25566", "[::1]:25566"},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		if w.Code != http.StatusOK || w.Body.String() != test.want {
+			t.Errorf("%s: got %d %q, want %q", test.path, w.Code, w.Body.String(), test.want)
+		}
+	}
+
+	for _, path := range []string{"/address", "/address?ip=example.com&port=0"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected the address to be rejected, got %d", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,612 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+)
+
+const (
+	// apiKeyHeader and apiKeyParam are where an API key may be sent.
+	apiKeyHeader = "X-API-Key"
+	apiKeyParam  = "key"
+
+	// apiKeyContext is where the ID of the key used is kept in the
+	// request context.
+	apiKeyContext = "apiKey"
+
+	// apiKeyRequester prefixes the requester of requests made with a key,
+	// which are limited by the key instead of by IP address.
+	apiKeyRequester = "key:"
+
+	// apiKeyUsageDays is how many days of usage are kept for each key.
+	apiKeyUsageDays = 30
+	// apiKeySaveInterval is how often usage is saved.
+	apiKeySaveInterval = time.Minute
+
+	apiKeyDayFormat = "2006-01-02"
+)
+
+// apiKeyTier is a set of default limits for keys. Zero means no limit.
+type apiKeyTier struct {
+	DailyQuota int
+	PerMinute  int
+	Burst      int
+}
+
+var apiKeyTiers = map[string]apiKeyTier{
+	"free":      {DailyQuota: 10000, PerMinute: 60, Burst: 20},
+	"standard":  {DailyQuota: 250000, PerMinute: 600, Burst: 100},
+	"unlimited": {},
+}
+
+const defaultAPIKeyTier = "free"
+
+// apiKey identifies an integration, which is limited by its own quotas
+// instead of by IP address.
+type apiKey struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Tier string `json:"tier"`
+	// Key is only included in the response when the key is created. It
+	// is never stored, only its hash.
+	Key  string `json:"key,omitempty"`
+	Hash string `json:"hash,omitempty"`
+
+	DailyQuota int `json:"daily_quota"`
+	PerMinute  int `json:"per_minute"`
+	Burst      int `json:"burst"`
+
+	// Endpoints are the path prefixes the key may be used for, and Origins
+	// the websites it may be used from. Empty means any.
+	Endpoints []string `json:"endpoints,omitempty"`
+	Origins   []string `json:"origins,omitempty"`
+
+	Created time.Time  `json:"created"`
+	Revoked *time.Time `json:"revoked,omitempty"`
+
+	// Usage is the number of requests made each day, keyed by UTC date.
+	Usage map[string]int64 `json:"usage,omitempty"`
+}
+
+type apiKeyRequest struct {
+	Name       string   `json:"name"`
+	Tier       string   `json:"tier"`
+	DailyQuota *int     `json:"daily_quota"`
+	PerMinute  *int     `json:"per_minute"`
+	Burst      *int     `json:"burst"`
+	Endpoints  []string `json:"endpoints"`
+	Origins    []string `json:"origins"`
+}
+
+// tokenBucket allows bursts of requests while limiting the average rate.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(burst float64, now time.Time) *tokenBucket {
+	return &tokenBucket{tokens: burst, last: now}
+}
+
+// take removes a token from the bucket, which is refilled at rate tokens
+// per second up to burst. If it is empty, it returns the number of seconds
+// until a token is available.
+func (b *tokenBucket) take(rate, burst float64, now time.Time) int {
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return int(math.Ceil((1 - b.tokens) / rate))
+	}
+
+	b.tokens--
+
+	return 0
+}
+
+// apiKeyStore holds every key, optionally saving them to a file.
+type apiKeyStore struct {
+	mu   sync.Mutex
+	path string
+	keys map[string]*apiKey
+	// byHash finds keys by the hash of the key sent with requests.
+	byHash  map[string]*apiKey
+	buckets map[string]*tokenBucket
+	dirty   bool
+}
+
+var apiKeys = &apiKeyStore{
+	keys:    map[string]*apiKey{},
+	byHash:  map[string]*apiKey{},
+	buckets: map[string]*tokenBucket{},
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// load reads keys from a file, which is then kept up to date.
+func (s *apiKeyStore) load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.path = path
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var saved []*apiKey
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	for _, key := range saved {
+		// Files written before secrets were dropped may still have them.
+		key.Key = ""
+		s.keys[key.ID] = key
+		s.byHash[key.Hash] = key
+	}
+
+	return nil
+}
+
+// save writes every key to the file, if there is one. It must be called
+// with the lock held.
+func (s *apiKeyStore) save() {
+	s.dirty = false
+
+	if s.path == "" {
+		return
+	}
+
+	saved := make([]*apiKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		saved = append(saved, key)
+	}
+
+	data, err := json.Marshal(saved)
+	if err == nil {
+		tmp := s.path + ".tmp"
+		if err = ioutil.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, s.path)
+		}
+	}
+
+	if err != nil {
+		raven.CaptureError(err, nil)
+		slog.Error("unable to save API keys", "err", err)
+	}
+}
+
+// persist periodically saves usage, which changes too often to save on
+// every request.
+func (s *apiKeyStore) persist() {
+	for range time.Tick(apiKeySaveInterval) {
+		s.mu.Lock()
+		if s.dirty {
+			s.save()
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *apiKeyStore) add(key *apiKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key.Key = ""
+
+	s.keys[key.ID] = key
+	s.byHash[key.Hash] = key
+	s.save()
+}
+
+// revoke stops a key from being used. It is kept so its usage can still
+// be inspected.
+func (s *apiKeyStore) revoke(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return false
+	}
+
+	if key.Revoked == nil {
+		now := time.Now().UTC()
+		key.Revoked = &now
+	}
+
+	delete(s.buckets, id)
+	s.save()
+
+	return true
+}
+
+// copyKey returns a copy of a key which is safe to respond with. It must be
+// called with the lock held.
+func copyKey(key *apiKey, usage bool) apiKey {
+	copied := *key
+	copied.Key = ""
+	copied.Hash = ""
+	copied.Usage = nil
+
+	if usage {
+		copied.Usage = make(map[string]int64, len(key.Usage))
+		for day, count := range key.Usage {
+			copied.Usage[day] = count
+		}
+	}
+
+	return copied
+}
+
+func (s *apiKeyStore) get(id string) (apiKey, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return apiKey{}, false
+	}
+
+	return copyKey(key, true), true
+}
+
+// list returns every key without usage, oldest first.
+func (s *apiKeyStore) list() []apiKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]apiKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, copyKey(key, false))
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Created.Before(keys[j].Created)
+	})
+
+	return keys
+}
+
+// allowedPath checks if a path is within one of the allowed prefixes.
+func allowedPath(prefixes []string, path string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// untilTomorrow is the number of seconds until the daily quota resets.
+func untilTomorrow(now time.Time) int {
+	tomorrow := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	return int(math.Ceil(tomorrow.Sub(now).Seconds()))
+}
+
+// authorize checks a request made with a key and counts it towards the
+// key's usage. It returns a copy of the key and how many requests remain
+// today, or -1 if there is no quota.
+func (s *apiKeyStore) authorize(secret, path, origin string, now time.Time) (apiKey, int64, *lookupError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.byHash[hashAPIKey(secret)]
+	if !ok || key.Revoked != nil {
+		return apiKey{}, 0, &lookupError{
+			Status:  http.StatusUnauthorized,
+			Code:    types.ErrorInvalidKey,
+			Message: "invalid API key",
+		}
+	}
+
+	if !allowedPath(key.Endpoints, path) {
+		return apiKey{}, 0, &lookupError{
+			Status:  http.StatusForbidden,
+			Code:    types.ErrorForbidden,
+			Message: "API key may not be used for this endpoint",
+		}
+	}
+
+	if len(key.Origins) > 0 && !containsString(key.Origins, origin) {
+		return apiKey{}, 0, &lookupError{
+			Status:  http.StatusForbidden,
+			Code:    types.ErrorForbidden,
+			Message: "API key may not be used from this origin",
+		}
+	}
+
+	day := now.UTC().Format(apiKeyDayFormat)
+
+	if key.DailyQuota > 0 && key.Usage[day] >= int64(key.DailyQuota) {
+		rateLimitRejections.WithLabelValues(rateLimitKeyQuota).Inc()
+
+		return apiKey{}, 0, &lookupError{
+			Status:   http.StatusTooManyRequests,
+			Code:     types.ErrorRateLimited,
+			Message:  "daily quota exceeded",
+			TryAfter: untilTomorrow(now),
+		}
+	}
+
+	if key.PerMinute > 0 {
+		rate := float64(key.PerMinute) / 60
+
+		burst := float64(key.Burst)
+		if burst <= 0 {
+			burst = float64(key.PerMinute)
+		}
+
+		bucket, ok := s.buckets[key.ID]
+		if !ok {
+			bucket = newTokenBucket(burst, now)
+			s.buckets[key.ID] = bucket
+		}
+
+		if tryAfter := bucket.take(rate, burst, now); tryAfter > 0 {
+			rateLimitRejections.WithLabelValues(rateLimitKeyBurst).Inc()
+
+			return apiKey{}, 0, &lookupError{
+				Status:   http.StatusTooManyRequests,
+				Code:     types.ErrorRateLimited,
+				Message:  "too many requests",
+				TryAfter: tryAfter,
+			}
+		}
+	}
+
+	if key.Usage == nil {
+		key.Usage = map[string]int64{}
+	}
+
+	if _, ok := key.Usage[day]; !ok {
+		oldest := now.UTC().AddDate(0, 0, -apiKeyUsageDays).Format(apiKeyDayFormat)
+		for d := range key.Usage {
+			if d <= oldest {
+				delete(key.Usage, d)
+			}
+		}
+	}
+
+	key.Usage[day]++
+	s.dirty = true
+
+	remaining := int64(-1)
+	if key.DailyQuota > 0 {
+		remaining = int64(key.DailyQuota) - key.Usage[day]
+	}
+
+	return copyKey(key, false), remaining, nil
+}
+
+// newAPIKey creates a key from a request, using the tier's limits unless
+// they are given. The secret is returned separately, as only its hash is
+// stored.
+func newAPIKey(req *apiKeyRequest) (*apiKey, string, error) {
+	if req.Name == "" {
+		return nil, "", errors.New("name is required")
+	}
+
+	tierName := req.Tier
+	if tierName == "" {
+		tierName = defaultAPIKeyTier
+	}
+
+	tier, ok := apiKeyTiers[tierName]
+	if !ok {
+		names := make([]string, 0, len(apiKeyTiers))
+		for name := range apiKeyTiers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return nil, "", fmt.Errorf("unknown tier %s, must be one of %s", tierName, strings.Join(names, ", "))
+	}
+
+	limit := func(value *int, fallback int) (int, error) {
+		if value == nil {
+			return fallback, nil
+		} else if *value < 0 {
+			return 0, errors.New("limits must not be negative")
+		}
+
+		return *value, nil
+	}
+
+	dailyQuota, err := limit(req.DailyQuota, tier.DailyQuota)
+	if err != nil {
+		return nil, "", err
+	}
+
+	perMinute, err := limit(req.PerMinute, tier.PerMinute)
+	if err != nil {
+		return nil, "", err
+	}
+
+	burst, err := limit(req.Burst, tier.Burst)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, endpoint := range req.Endpoints {
+		if !strings.HasPrefix(endpoint, "/") {
+			return nil, "", fmt.Errorf("endpoint %s must be a path starting with /", endpoint)
+		}
+	}
+
+	secret := "mcapi_" + randomHex(24)
+
+	return &apiKey{
+		ID:         randomHex(8),
+		Name:       req.Name,
+		Tier:       tierName,
+		Hash:       hashAPIKey(secret),
+		DailyQuota: dailyQuota,
+		PerMinute:  perMinute,
+		Burst:      burst,
+		Endpoints:  req.Endpoints,
+		Origins:    req.Origins,
+		Created:    time.Now().UTC(),
+	}, secret, nil
+}
+
+// abortKey responds to a rejected key in the style of the requested API
+// version.
+func abortKey(c *gin.Context, err *lookupError) {
+	if strings.HasPrefix(c.Request.URL.Path, "/v2/") {
+		abortV2(c, err)
+	} else {
+		abortLookup(c, err)
+	}
+}
+
+// checkAPIKey authorizes requests made with an API key. Requests without a
+// key continue to be limited by IP address.
+func checkAPIKey(c *gin.Context) {
+	secret := c.GetHeader(apiKeyHeader)
+	if secret == "" {
+		secret = c.Query(apiKeyParam)
+	}
+
+	if secret == "" {
+		return
+	}
+
+	key, remaining, err := apiKeys.authorize(secret, c.Request.URL.Path, c.GetHeader("Origin"), time.Now())
+	if err != nil {
+		abortKey(c, err)
+		return
+	}
+
+	if remaining >= 0 {
+		c.Header("X-RateLimit-Limit", strconv.Itoa(key.DailyQuota))
+		c.Header("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+	}
+
+	c.Set(apiKeyContext, key.ID)
+}
+
+// proxyHeaders are the headers proxies put the client's address in.
+var proxyHeaders = []string{"CF-Connecting-IP", "X-Forwarded-For", "X-Real-IP"}
+
+// trustProxies only uses the client address in a proxy's headers for
+// requests from one of proxies.
+func trustProxies(router *gin.Engine, proxies []string) error {
+	router.RemoteIPHeaders = proxyHeaders
+
+	return router.SetTrustedProxies(proxies)
+}
+
+var proxyWarning sync.Once
+
+// warnProxyHeaders logs once if a request has a proxy's client address
+// headers while no proxies are trusted, as every user behind the proxy is
+// then rate limited together.
+func warnProxyHeaders(c *gin.Context) {
+	for _, header := range proxyHeaders {
+		if c.GetHeader(header) == "" {
+			continue
+		}
+
+		proxyWarning.Do(func() {
+			slog.Warn("request has proxy headers but TrustedProxies is not set, so clients are identified by the proxy's address", "header", header, "remote_addr", c.Request.RemoteAddr)
+		})
+
+		break
+	}
+
+	c.Next()
+}
+
+// requester identifies who made a request for rate limiting, by API key if
+// one was used or otherwise by IP address.
+func requester(c *gin.Context) string {
+	if id := c.GetString(apiKeyContext); id != "" {
+		return apiKeyRequester + id
+	}
+
+	// ClientIP only uses headers from trusted proxies, and only when they
+	// hold an IP address, so a client can't claim to be an API key.
+	return c.ClientIP()
+}
+
+func respondCreateAPIKey(c *gin.Context) {
+	var req apiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, secret, err := newAPIKey(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The secret is only ever included in this response.
+	created := copyKey(key, false)
+	created.Key = secret
+
+	apiKeys.add(key)
+
+	logger(c.Request.Context()).Info("created API key", "key_id", key.ID, "name", key.Name)
+
+	c.JSON(http.StatusCreated, created)
+}
+
+func respondAPIKeys(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"keys": apiKeys.list(),
+	})
+}
+
+func respondAPIKey(c *gin.Context) {
+	key, ok := apiKeys.get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown API key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+func respondRevokeAPIKey(c *gin.Context) {
+	if !apiKeys.revoke(c.Param("id")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown API key"})
+		return
+	}
+
+	logger(c.Request.Context()).Info("revoked API key", "key_id", c.Param("id"))
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func newTestKey(t *testing.T, req *apiKeyRequest) (*apiKeyStore, *apiKey, string) {
+	store := &apiKeyStore{
+		keys:    map[string]*apiKey{},
+		byHash:  map[string]*apiKey{},
+		buckets: map[string]*tokenBucket{},
+	}
+
+	key, secret, err := newAPIKey(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.add(key)
+
+	return store, key, secret
+}
+
+func TestAPIKeySecretNotKept(t *testing.T) {
+	store, key, secret := newTestKey(t, &apiKeyRequest{Name: "test", Tier: "unlimited"})
+
+	store.path = filepath.Join(t.TempDir(), "keys.json")
+	store.mu.Lock()
+	store.save()
+	store.mu.Unlock()
+
+	data, err := ioutil.ReadFile(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(data), secret) {
+		t.Error("expected the secret not to be saved")
+	}
+
+	if got, _ := store.get(key.ID); got.Key != "" {
+		t.Error("expected the secret not to be returned with the key")
+	}
+
+	for _, listed := range store.list() {
+		if listed.Key != "" {
+			t.Error("expected the secret not to be listed")
+		}
+	}
+
+	if _, _, err := store.authorize(secret, "/server/status", "", time.Now()); err != nil {
+		t.Errorf("expected the secret to still be accepted, got %v", err)
+	}
+}
+
+func TestAPIKeyQuota(t *testing.T) {
+	store, key, secret := newTestKey(t, &apiKeyRequest{
+		Name:       "test",
+		DailyQuota: intPtr(2),
+		PerMinute:  intPtr(0),
+	})
+
+	now := time.Date(2020, 1, 1, 23, 0, 0, 0, time.UTC)
+
+	for i := int64(1); i >= 0; i-- {
+		_, remaining, err := store.authorize(secret, "/server/status", "", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if remaining != i {
+			t.Errorf("expected %d requests remaining, got %d", i, remaining)
+		}
+	}
+
+	_, _, err := store.authorize(secret, "/server/status", "", now)
+	if err == nil || err.Code != types.ErrorRateLimited || err.TryAfter != 3600 {
+		t.Errorf("expected the quota to be exceeded for an hour, got %v", err)
+	}
+
+	if _, _, err := store.authorize(secret, "/server/status", "", now.Add(time.Hour)); err != nil {
+		t.Errorf("expected the quota to reset the next day, got %v", err)
+	}
+
+	stored, _ := store.get(key.ID)
+	if stored.Usage["2020-01-01"] != 2 || stored.Usage["2020-01-02"] != 1 {
+		t.Errorf("unexpected usage %v", stored.Usage)
+	}
+}
+
+func TestAPIKeyBurst(t *testing.T) {
+	store, _, secret := newTestKey(t, &apiKeyRequest{
+		Name:       "test",
+		DailyQuota: intPtr(0),
+		PerMinute:  intPtr(60),
+		Burst:      intPtr(2),
+	})
+
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := store.authorize(secret, "/server/status", "", now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, _, err := store.authorize(secret, "/server/status", "", now); err == nil || err.TryAfter != 1 {
+		t.Errorf("expected the burst to be exceeded, got %v", err)
+	}
+
+	if _, _, err := store.authorize(secret, "/server/status", "", now.Add(time.Second)); err != nil {
+		t.Errorf("expected a token to be added after a second, got %v", err)
+	}
+}
+
+func TestAPIKeyRestrictions(t *testing.T) {
+	store, key, secret := newTestKey(t, &apiKeyRequest{
+		Name:      "test",
+		Endpoints: []string{"/v2/server"},
+		Origins:   []string{"https://example.com"},
+	})
+
+	now := time.Now()
+
+	if _, _, err := store.authorize(secret, "/v2/server/status/example.com", "https://example.com", now); err != nil {
+		t.Errorf("expected the request to be allowed, got %v", err)
+	}
+
+	if _, _, err := store.authorize(secret, "/server/status", "https://example.com", now); err == nil || err.Code != types.ErrorForbidden {
+		t.Errorf("expected the endpoint to be forbidden, got %v", err)
+	}
+
+	if _, _, err := store.authorize(secret, "/v2/server/status", "https://example.org", now); err == nil || err.Code != types.ErrorForbidden {
+		t.Errorf("expected the origin to be forbidden, got %v", err)
+	}
+
+	store.revoke(key.ID)
+
+	if _, _, err := store.authorize(secret, "/v2/server/status", "https://example.com", now); err == nil || err.Code != types.ErrorInvalidKey {
+		t.Errorf("expected the revoked key to be rejected, got %v", err)
+	}
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store, key, secret := newTestKey(t, &apiKeyRequest{Name: "test", Tier: "unlimited"})
+
+	previous := apiKeys
+	apiKeys = store
+	defer func() { apiKeys = previous }()
+
+	var got string
+
+	router := gin.New()
+	router.Use(checkAPIKey)
+	router.GET("/v2/server/status", func(c *gin.Context) {
+		got = requester(c)
+	})
+
+	if err := trustProxies(router, []string{"198.51.100.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(header, secret string) int {
+		req := httptest.NewRequest(http.MethodGet, "/v2/server/status", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if secret != "" {
+			req.Header.Set(header, secret)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		return w.Code
+	}
+
+	if code := request(apiKeyHeader, secret); code != http.StatusOK || got != apiKeyRequester+key.ID {
+		t.Errorf("expected the key to be used, got %d for %s", code, got)
+	}
+
+	if code := request("", ""); code != http.StatusOK || got != "192.0.2.1" {
+		t.Errorf("expected anonymous requests to use the IP address, got %d for %s", code, got)
+	}
+
+	for _, remote := range []string{"192.0.2.1:1234", "198.51.100.1:1234"} {
+		req := httptest.NewRequest(http.MethodGet, "/v2/server/status", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("CF-Connecting-IP", apiKeyRequester+key.ID)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		if strings.HasPrefix(got, apiKeyRequester) {
+			t.Errorf("expected the header not to be used as a key from %s, got %s", remote, got)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/server/status", nil)
+	req.RemoteAddr = "198.51.100.1:1234"
+	req.Header.Set("CF-Connecting-IP", "203.0.113.1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got != "203.0.113.1" {
+		t.Errorf("expected the address from a trusted proxy to be used, got %s", got)
+	}
+
+	if code := request(apiKeyHeader, "mcapi_unknown"); code != http.StatusUnauthorized {
+		t.Errorf("expected an unknown key to be rejected, got %d", code)
+	}
+
+	if limit, _ := shouldRateLimit(context.Background(), apiKeyRequester+key.ID); limit {
+		t.Error("expected requests with a key to skip the IP rate limit")
+	}
+}
+
+func TestWarnProxyHeaders(t *testing.T) {
+	var buf bytes.Buffer
+
+	previous := slog.Default()
+	slog.SetDefault(slog.New(newLogHandler(&buf, logFormatJSON, slog.LevelInfo)))
+	defer slog.SetDefault(previous)
+
+	proxyWarning = sync.Once{}
+
+	router := gin.New()
+	router.Use(warnProxyHeaders)
+	router.GET("/server/status", func(c *gin.Context) {})
+
+	for _, header := range []string{"", "X-Forwarded-For", "CF-Connecting-IP"} {
+		req := httptest.NewRequest(http.MethodGet, "/server/status", nil)
+		if header != "" {
+			req.Header.Set(header, "203.0.113.1")
+		}
+
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if n := strings.Count(buf.String(), "TrustedProxies is not set"); n != 1 {
+		t.Errorf("expected one warning, got %d: %s", n, buf.String())
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+)
+
+const (
+	defaultBatchMaxAddresses = 100
+	defaultBatchWorkers      = 10
+
+	// batchAddressBytes is how much of a POST body each address may use,
+	// allowing for long hostnames and JSON quoting.
+	batchAddressBytes = 512
+)
+
+// batchMaxAddresses is the most servers which may be requested at once, and
+// batchWorkers how many uncached servers from one request are pinged at once.
+var batchMaxAddresses = defaultBatchMaxAddresses
+var batchWorkers = defaultBatchWorkers
+
+// batchSlots limits how many interactive lane slots every batch together
+// may use, so single server lookups are never starved by large batches.
+var batchSlots = newBatchSlots(interactiveLane)
+
+// newBatchSlots allows batches to use at most half of a lane's slots.
+func newBatchSlots(l *lane) chan struct{} {
+	n := l.capacity() / 2
+	if n < 1 {
+		n = 1
+	}
+
+	return make(chan struct{}, n)
+}
+
+// runBatchProbe waits for one of the slots shared by batches and then runs
+// fn in the interactive lane.
+func runBatchProbe(ctx context.Context, fn func()) error {
+	queuedAt := time.Now()
+
+	select {
+	case batchSlots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-batchSlots }()
+
+	return interactiveLane.run(ctx, queuedAt, fn)
+}
+
+type batchRequest struct {
+	Addresses []string `json:"addresses"`
+}
+
+// batchAddresses reads the requested addresses, either from a JSON body or
+// from repeated address parameters, removing duplicates.
+func batchAddresses(c *gin.Context) ([]string, error) {
+	var addresses []string
+
+	if c.Request.Method == http.MethodPost {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(batchMaxAddresses*batchAddressBytes))
+
+		var req batchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, err
+		}
+
+		addresses = req.Addresses
+	} else {
+		addresses = c.QueryArray("address")
+	}
+
+	return parseAddresses(addresses)
+}
+
+// parseAddresses parses many addresses, removing duplicates and checking
+// that there are not too many.
+func parseAddresses(addresses []string) ([]string, error) {
+	seen := map[string]bool{}
+	var serverAddrs []string
+
+	for _, address := range addresses {
+		addr, err := parseAddress(address)
+		if err == errMissingAddress {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %s", err, address)
+		}
+
+		if seen[addr] {
+			continue
+		}
+
+		seen[addr] = true
+		serverAddrs = append(serverAddrs, addr)
+	}
+
+	if len(serverAddrs) == 0 {
+		return nil, errMissingAddress
+	}
+
+	if len(serverAddrs) > batchMaxAddresses {
+		return nil, fmt.Errorf("too many addresses, at most %d may be requested", batchMaxAddresses)
+	}
+
+	return serverAddrs, nil
+}
+
+// batchStatus returns the status of every server, pinging those which are
+// not cached with at most batchWorkers at once, within the batch share of
+// the interactive lane. It also returns how many servers were not cached.
+func batchStatus(ctx context.Context, serverAddrs []string) (map[string]*types.ServerStatus, int) {
+	results := make(map[string]*types.ServerStatus, len(serverAddrs))
+
+	var misses []string
+
+	for _, serverAddr := range serverAddrs {
+		status, ok := lookupCache(ctx, eventStatus, pingMap, serverAddr)
+
+		if ok {
+			results[serverAddr] = status.(*types.ServerStatus)
+		} else {
+			misses = append(misses, serverAddr)
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	sem := make(chan struct{}, batchWorkers)
+
+	for _, serverAddr := range misses {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(serverAddr string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			pingCtx, cancel := context.WithTimeout(ctx, statusTimeout)
+			defer cancel()
+
+			status := &types.ServerStatus{
+				Status: "error",
+				Error:  errBusy,
+			}
+
+			runBatchProbe(pingCtx, func() {
+				status = updatePing(pingCtx, serverAddr)
+			})
+
+			mu.Lock()
+			results[serverAddr] = status
+			mu.Unlock()
+		}(serverAddr)
+	}
+
+	wg.Wait()
+
+	return results, len(misses)
+}
+
+// batchQuery returns the query of every server, querying those which are
+// not cached with at most batchWorkers at once, within the batch share of
+// the interactive lane.
+func batchQuery(ctx context.Context, serverAddrs []string) map[string]*types.ServerQuery {
+	results := make(map[string]*types.ServerQuery, len(serverAddrs))
+
+	var misses []string
+
+	for _, serverAddr := range serverAddrs {
+		query, ok := lookupCache(ctx, eventQuery, queryMap, serverAddr)
+
+		if ok {
+			results[serverAddr] = query.(*types.ServerQuery)
+		} else {
+			misses = append(misses, serverAddr)
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	sem := make(chan struct{}, batchWorkers)
+
+	for _, serverAddr := range misses {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(serverAddr string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			queryCtx, cancel := context.WithTimeout(ctx, queryTimeout)
+			defer cancel()
+
+			query := &types.ServerQuery{
+				Status: "error",
+				Error:  errBusy,
+			}
+
+			runBatchProbe(queryCtx, func() {
+				query = updateQuery(queryCtx, serverAddr)
+			})
+
+			mu.Lock()
+			results[serverAddr] = query
+			mu.Unlock()
+		}(serverAddr)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// rateLimitedBatchStatus returns the status of every server. The whole
+// batch counts as one request for rate limiting, weighted by how many
+// servers had to be pinged.
+func rateLimitedBatchStatus(ctx context.Context, serverAddrs []string, ip string) (map[string]*types.ServerStatus, *lookupError) {
+	if limit, count := shouldRateLimit(ctx, ip); limit {
+		return nil, rateLimitedError(count)
+	}
+
+	results, misses := batchStatus(ctx, serverAddrs)
+
+	if misses > 0 {
+		incrRateLimitBy(ip, misses)
+	}
+
+	return results, nil
+}
+
+func respondServerStatusBatch(c *gin.Context) {
+	serverAddrs, err := batchAddresses(c)
+	if err != nil {
+		render(c, http.StatusBadRequest, &types.ServerStatusBatch{
+			Status: "error",
+			Error:  err.Error(),
+		})
+		return
+	}
+
+	results, lookupErr := rateLimitedBatchStatus(c.Request.Context(), serverAddrs, requester(c))
+	if lookupErr != nil {
+		abortLookup(c, lookupErr)
+		return
+	}
+
+	sel := requestFields(c, batchDefaultExclude...)
+
+	batch := &trimmedBatch{
+		Status:  "success",
+		Servers: map[string]json.RawMessage{},
+	}
+
+	for serverAddr, status := range results {
+		data, err := sel.trimmed(pingMap, serverAddr, "v1", status, status)
+		if err != nil {
+			c.Error(err)
+			continue
+		}
+
+		batch.Servers[serverAddr] = data
+	}
+
+	render(c, http.StatusOK, batch)
+}
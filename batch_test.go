@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAddresses(t *testing.T) {
+	previous := batchMaxAddresses
+	batchMaxAddresses = 3
+	defer func() { batchMaxAddresses = previous }()
+
+	got, err := parseAddresses([]string{"Example.com", "example.com:25565", "", "b.example.com:25566"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 2 || got[0] != "example.com:25565" || got[1] != "b.example.com:25566" {
+		t.Errorf("expected duplicates and empty addresses to be removed, got %v", got)
+	}
+
+	if _, err := parseAddresses([]string{"a", "b", "c", "d"}); err == nil {
+		t.Error("expected too many addresses to be rejected")
+	}
+
+	if _, err := parseAddresses([]string{"a", "b:notaport"}); err == nil || !strings.Contains(err.Error(), "b:notaport") {
+		t.Errorf("expected the invalid address to be named, got %v", err)
+	}
+
+	if _, err := parseAddresses(nil); err != errMissingAddress {
+		t.Errorf("expected a missing address, got %v", err)
+	}
+}
+
+func TestBatchPost(t *testing.T) {
+	router := fieldsRouter()
+	router.POST("/server/status/batch", respondServerStatusBatch)
+
+	req := httptest.NewRequest(http.MethodPost, "/server/status/batch", strings.NewReader(`{"addresses":["example.com","EXAMPLE.COM:25565"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "192.0.2.20:1234"
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"example.com:25565":{`) {
+		t.Errorf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+
+	if rateLimit.Get("192.0.2.20") != nil {
+		t.Error("expected cached servers not to count towards the rate limit")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/server/status/batch", strings.NewReader(`{"addresses":`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected a malformed body to be rejected, got %d", w.Code)
+	}
+}
+
+func TestBatchPostTooLarge(t *testing.T) {
+	previous := batchMaxAddresses
+	batchMaxAddresses = 2
+	defer func() { batchMaxAddresses = previous }()
+
+	router := fieldsRouter()
+	router.POST("/server/status/batch", respondServerStatusBatch)
+
+	body := `{"addresses":["example.com","` + strings.Repeat("a", 2*batchAddressBytes) + `"]}`
+
+	req := httptest.NewRequest(http.MethodPost, "/server/status/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected an oversized body to be rejected, got %d", w.Code)
+	}
+}
+
+func TestBatchShare(t *testing.T) {
+	previous, previousSlots := interactiveLane, batchSlots
+	interactiveLane = newLane(laneInteractive, 4)
+	batchSlots = newBatchSlots(interactiveLane)
+	defer func() { interactiveLane, batchSlots = previous, previousSlots }()
+
+	for i := 0; i < cap(batchSlots); i++ {
+		batchSlots <- struct{}{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := runBatchProbe(ctx, func() {}); err == nil {
+		t.Error("expected batches to wait once they use their share of the lane")
+	}
+
+	ran := false
+	if err := interactiveLane.run(context.Background(), time.Now(), func() { ran = true }); err != nil || !ran {
+		t.Errorf("expected single lookups to still have slots, got %v", err)
+	}
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+)
+
+// evictionWindow is how many of the least recently used entries are
+// considered when choosing one to evict. Within it, offline servers are
+// evicted first, then those requested least often.
+const evictionWindow = 16
+
+// maxTrimmedForms is the most trimmed forms kept for each entry. Others
+// are created for each request.
+const maxTrimmedForms = 8
+
+// serverCache holds the latest result for each tracked server. It may be
+// limited to a number of entries and an approximate number of bytes, past
+// which the least useful entries are evicted and stop being refreshed.
+type serverCache struct {
+	mu sync.Mutex
+
+	entries map[string]*list.Element
+	// order has the most recently requested entries at the front.
+	order *list.List
+
+	maxEntries int
+	maxBytes   int64
+
+	bytes     int64
+	evictions int64
+}
+
+type cacheEntry struct {
+	key   string
+	value interface{}
+	size  int64
+	hits  int64
+
+	// trimmed holds encoded forms of value with some fields removed,
+	// keyed by which fields. They are discarded when value changes.
+	trimmed map[string]json.RawMessage
+	// hash identifies the content of value, for ETags. It is created when
+	// first needed and discarded when value changes.
+	hash string
+}
+
+// cacheStats describes how full a cache is.
+type cacheStats struct {
+	Entries    int   `json:"entries"`
+	MaxEntries int   `json:"max_entries"`
+	Bytes      int64 `json:"bytes"`
+	MaxBytes   int64 `json:"max_bytes"`
+	Evictions  int64 `json:"evictions"`
+}
+
+// newServerCache creates a cache. A limit of zero means no limit.
+func newServerCache(maxEntries int, maxBytes int64) *serverCache {
+	return &serverCache{
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+	}
+}
+
+// GetOK returns the value for a server, counting it as a request.
+func (sc *serverCache) GetOK(key string) (interface{}, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	elem, ok := sc.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	entry.hits++
+
+	sc.order.MoveToFront(elem)
+
+	return entry.value, true
+}
+
+// Has returns if a server is cached, without counting it as a request.
+func (sc *serverCache) Has(key string) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	_, ok := sc.entries[key]
+
+	return ok
+}
+
+// Set stores the value for a server. Updating an existing entry does not
+// count as a request, so background refreshes don't keep servers cached.
+func (sc *serverCache) Set(key string, value interface{}) {
+	sc.Swap(key, value)
+}
+
+// Swap stores the value for a server like Set, returning the previous value.
+func (sc *serverCache) Swap(key string, value interface{}) interface{} {
+	size := entrySize(key, value)
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	var previous interface{}
+
+	elem, ok := sc.entries[key]
+	if ok {
+		entry := elem.Value.(*cacheEntry)
+		previous = entry.value
+
+		sc.bytes += size - entry.size
+
+		entry.value = value
+		entry.size = size
+		entry.trimmed = nil
+		entry.hash = ""
+	} else {
+		elem = sc.order.PushFront(&cacheEntry{
+			key:   key,
+			value: value,
+			size:  size,
+		})
+		sc.entries[key] = elem
+
+		sc.bytes += size
+	}
+
+	sc.evict(elem)
+
+	return previous
+}
+
+// Trimmed returns a form of a server's value, creating it with trim the
+// first time it is requested. If value is no longer the cached value, or
+// the entry already has maxTrimmedForms forms, the form is created but not
+// kept.
+func (sc *serverCache) Trimmed(key, form string, value interface{}, trim func() (json.RawMessage, error)) (json.RawMessage, error) {
+	sc.mu.Lock()
+	if elem, ok := sc.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if data, ok := entry.trimmed[form]; ok && entry.value == value {
+			sc.mu.Unlock()
+			return data, nil
+		}
+	}
+	sc.mu.Unlock()
+
+	data, err := trim()
+	if err != nil {
+		return nil, err
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if elem, ok := sc.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if entry.value == value {
+			if entry.trimmed == nil {
+				entry.trimmed = map[string]json.RawMessage{}
+			}
+
+			previous, ok := entry.trimmed[form]
+			if !ok && len(entry.trimmed) >= maxTrimmedForms {
+				return data, nil
+			}
+
+			size := int64(len(form) + len(data))
+			if ok {
+				size -= int64(len(form) + len(previous))
+			}
+
+			entry.trimmed[form] = data
+			entry.size += size
+			sc.bytes += size
+
+			sc.evict(elem)
+		}
+	}
+
+	return data, nil
+}
+
+// Hash returns a hash of the content of a server's value, creating it the
+// first time it is requested. If value is no longer the cached value, the
+// hash is created but not kept.
+func (sc *serverCache) Hash(key string, value interface{}) (string, error) {
+	sc.mu.Lock()
+	if elem, ok := sc.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if entry.hash != "" && entry.value == value {
+			sc.mu.Unlock()
+			return entry.hash, nil
+		}
+	}
+	sc.mu.Unlock()
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	hash := contentETag(data)
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if elem, ok := sc.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if entry.value == value {
+			entry.hash = hash
+		}
+	}
+
+	return hash, nil
+}
+
+func (sc *serverCache) Delete(key string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if elem, ok := sc.entries[key]; ok {
+		sc.remove(elem)
+	}
+}
+
+// ForEach calls fn for a snapshot of every entry, so fn may modify the cache.
+func (sc *serverCache) ForEach(fn func(key string, val interface{}) bool) {
+	sc.mu.Lock()
+	entries := make([]*cacheEntry, 0, len(sc.entries))
+	for elem := sc.order.Front(); elem != nil; elem = elem.Next() {
+		entry := *elem.Value.(*cacheEntry)
+		entries = append(entries, &entry)
+	}
+	sc.mu.Unlock()
+
+	for _, entry := range entries {
+		if !fn(entry.key, entry.value) {
+			return
+		}
+	}
+}
+
+// ForEachLocked calls fn for every entry while holding the lock, so fn
+// must not modify the cache.
+func (sc *serverCache) ForEachLocked(fn func(key string, val interface{}) bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for elem := sc.order.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*cacheEntry)
+
+		if !fn(entry.key, entry.value) {
+			return
+		}
+	}
+}
+
+func (sc *serverCache) Len() int {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	return len(sc.entries)
+}
+
+func (sc *serverCache) stats() cacheStats {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	return cacheStats{
+		Entries:    len(sc.entries),
+		MaxEntries: sc.maxEntries,
+		Bytes:      sc.bytes,
+		MaxBytes:   sc.maxBytes,
+		Evictions:  sc.evictions,
+	}
+}
+
+func (sc *serverCache) overLimit() bool {
+	if sc.maxEntries > 0 && len(sc.entries) > sc.maxEntries {
+		return true
+	}
+
+	return sc.maxBytes > 0 && sc.bytes > sc.maxBytes
+}
+
+// evict removes entries until the cache is within its limits, other than
+// keep, the entry which was just changed. It must be called with the lock
+// held.
+func (sc *serverCache) evict(keep *list.Element) {
+	for sc.overLimit() {
+		var victim *list.Element
+
+		elem := sc.order.Back()
+		for i := 0; i < evictionWindow && elem != nil; elem = elem.Prev() {
+			if elem == keep {
+				continue
+			}
+
+			if victim == nil || evictBefore(elem.Value.(*cacheEntry), victim.Value.(*cacheEntry)) {
+				victim = elem
+			}
+
+			i++
+		}
+
+		if victim == nil {
+			return
+		}
+
+		sc.remove(victim)
+		sc.evictions++
+	}
+}
+
+func (sc *serverCache) remove(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+
+	sc.order.Remove(elem)
+	delete(sc.entries, entry.key)
+
+	sc.bytes -= entry.size
+}
+
+// evictBefore reports whether a should be evicted in preference to b.
+func evictBefore(a, b *cacheEntry) bool {
+	aOnline, bOnline := entryOnline(a.value), entryOnline(b.value)
+	if aOnline != bOnline {
+		return !aOnline
+	}
+
+	return a.hits < b.hits
+}
+
+func entryOnline(value interface{}) bool {
+	switch v := value.(type) {
+	case *types.ServerStatus:
+		return v.Online
+	case *types.ServerQuery:
+		return v.Online
+	}
+
+	return false
+}
+
+// entryOverhead approximates the memory used by an entry other than the
+// contents of its value's strings and slices.
+const entryOverhead = 256
+
+// entrySize approximates the memory used by an entry, which is dominated by
+// the favicon for most servers.
+func entrySize(key string, value interface{}) int64 {
+	size := entryOverhead + len(key)
+
+	switch v := value.(type) {
+	case *types.ServerStatus:
+		size += len(v.Status) + len(v.Motd) + len(v.MotdFormatted) + len(v.Favicon) + len(v.Error) +
+			len(v.Server.Name) + len(v.LastOnline) + len(v.LastUpdated) + genericSize(v.MotdExtra)
+	case *types.ServerQuery:
+		size += len(v.Status) + len(v.Error) + len(v.Motd) + len(v.Version) + len(v.GameType) +
+			len(v.GameID) + len(v.ServerMod) + len(v.Map) + len(v.LastOnline) + len(v.LastUpdated) +
+			stringsSize(v.Players.List) + stringsSize(v.Plugins)
+	case *encodedIcon:
+		size += len(v.data)
+	}
+
+	return int64(size)
+}
+
+func stringsSize(list []string) int {
+	size := 16 * len(list)
+	for _, s := range list {
+		size += len(s)
+	}
+
+	return size
+}
+
+// genericSize approximates the memory used by decoded JSON.
+func genericSize(v interface{}) int {
+	switch val := v.(type) {
+	case string:
+		return 16 + len(val)
+	case []interface{}:
+		size := 24
+		for _, item := range val {
+			size += genericSize(item)
+		}
+
+		return size
+	case map[string]interface{}:
+		size := 48
+		for k, item := range val {
+			size += 16 + len(k) + genericSize(item)
+		}
+
+		return size
+	}
+
+	return 16
+}
+
+func respondCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": pingMap.stats(),
+		"query":  queryMap.stats(),
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/syfaro/mcapi/types"
+)
+
+func TestCacheEvictsOfflineFirst(t *testing.T) {
+	cache := newServerCache(3, 0)
+
+	cache.Set("a", &types.ServerStatus{Online: true})
+	cache.Set("b", &types.ServerStatus{Online: false})
+	cache.Set("c", &types.ServerStatus{Online: true})
+	cache.Set("d", &types.ServerStatus{Online: true})
+
+	if cache.Has("b") || !cache.Has("a") || cache.Len() != 3 {
+		t.Errorf("expected the offline server to be evicted, got %d entries", cache.Len())
+	}
+
+	if stats := cache.stats(); stats.Evictions != 1 {
+		t.Errorf("expected one eviction, got %d", stats.Evictions)
+	}
+}
+
+func TestCacheEvictsLeastRequested(t *testing.T) {
+	cache := newServerCache(3, 0)
+
+	cache.Set("a", &types.ServerStatus{Online: true})
+	cache.Set("b", &types.ServerStatus{Online: true})
+	cache.Set("c", &types.ServerStatus{Online: true})
+
+	cache.GetOK("a")
+	cache.GetOK("a")
+	cache.GetOK("c")
+
+	cache.Set("d", &types.ServerStatus{Online: true})
+
+	if cache.Has("b") || !cache.Has("a") || !cache.Has("c") {
+		t.Error("expected the least requested server to be evicted")
+	}
+}
+
+func TestCacheKeepsNewEntry(t *testing.T) {
+	cache := newServerCache(2, 0)
+
+	cache.Set("a", &types.ServerStatus{Online: true})
+	cache.GetOK("a")
+	cache.Set("b", &types.ServerStatus{Online: true})
+	cache.GetOK("b")
+
+	// The new entry is offline and has never been requested, so it would
+	// be chosen if it were considered.
+	cache.Set("c", &types.ServerStatus{Online: false})
+
+	if !cache.Has("c") || cache.Len() != 2 {
+		t.Error("expected the new entry to be kept")
+	}
+}
+
+func TestCacheByteLimit(t *testing.T) {
+	favicon := strings.Repeat("a", 4096)
+
+	cache := newServerCache(0, 2*entrySize("a", &types.ServerStatus{Favicon: favicon}))
+
+	cache.Set("a", &types.ServerStatus{Favicon: favicon})
+	cache.Set("b", &types.ServerStatus{Favicon: favicon})
+	cache.Set("c", &types.ServerStatus{Favicon: favicon})
+
+	if cache.Has("a") || cache.Len() != 2 {
+		t.Errorf("expected the oldest entry to be evicted, got %d entries", cache.Len())
+	}
+
+	// An entry larger than the limit is kept, as there is nothing else to
+	// evict once the others are gone.
+	cache.Set("d", &types.ServerStatus{Favicon: strings.Repeat("a", 16384)})
+
+	if !cache.Has("d") || cache.Len() != 1 {
+		t.Errorf("expected only the large entry, got %d entries", cache.Len())
+	}
+
+	cache.Delete("d")
+
+	if stats := cache.stats(); stats.Bytes != 0 {
+		t.Errorf("expected no bytes once empty, got %d", stats.Bytes)
+	}
+}
+
+func TestEntrySize(t *testing.T) {
+	small := entrySize("a", &types.ServerStatus{Motd: "hi"})
+	large := entrySize("a", &types.ServerStatus{Motd: "hi", Favicon: strings.Repeat("a", 4096)})
+
+	if large-small != 4096 {
+		t.Errorf("expected the favicon to be counted, got %d and %d", small, large)
+	}
+
+	extra := entrySize("a", &types.ServerStatus{MotdExtra: []interface{}{
+		map[string]interface{}{"text": strings.Repeat("a", 100), "bold": true},
+	}})
+
+	if extra-entrySize("a", &types.ServerStatus{}) < 100 {
+		t.Errorf("expected formatted MOTDs to be counted, got %d", extra)
+	}
+
+	query := entrySize("a", &types.ServerQuery{Plugins: []string{strings.Repeat("a", 100)}})
+	if query-entrySize("a", &types.ServerQuery{}) < 100 {
+		t.Errorf("expected plugins to be counted, got %d", query)
+	}
+}
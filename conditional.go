@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contentETag creates a strong ETag from the content of a response.
+func contentETag(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write(part)
+	}
+
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// parseLastUpdated parses a last_updated timestamp, returning the zero time
+// if the result has never been updated.
+func parseLastUpdated(lastUpdated string) time.Time {
+	i, err := strconv.ParseInt(lastUpdated, 10, 64)
+	if err != nil || i == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(i, 0)
+}
+
+// freshFor is how long a result may be cached, which is until the
+// next scheduled refresh.
+func freshFor(lastUpdated time.Time) time.Duration {
+	if lastUpdated.IsZero() {
+		return 0
+	}
+
+	fresh := updateInterval - time.Since(lastUpdated)
+	if fresh < 0 {
+		return 0
+	} else if fresh > updateInterval {
+		return updateInterval
+	}
+
+	return fresh
+}
+
+// notModified sets the ETag, Last-Modified and Cache-Control headers for a
+// result. If the client's copy is still current, it responds with 304 Not
+// Modified and returns true.
+func notModified(c *gin.Context, etag string, lastUpdated time.Time) bool {
+	header := c.Writer.Header()
+
+	maxAge := int(freshFor(lastUpdated).Seconds())
+
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", fmt.Sprintf("max-age=%d, public, s-maxage=%d", maxAge, maxAge))
+
+	if !lastUpdated.IsZero() {
+		header.Set("Last-Modified", lastUpdated.UTC().Format(http.TimeFormat))
+	}
+
+	// If-Modified-Since is ignored when If-None-Match is present.
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		if !etagMatches(match, etag) {
+			return false
+		}
+	} else if since := c.GetHeader("If-Modified-Since"); since != "" && !lastUpdated.IsZero() {
+		t, err := http.ParseTime(since)
+		if err != nil || lastUpdated.Truncate(time.Second).After(t) {
+			return false
+		}
+	} else {
+		return false
+	}
+
+	c.AbortWithStatus(http.StatusNotModified)
+
+	return true
+}
+
+// etagMatches checks an If-None-Match header, which may contain a list of
+// ETags or a wildcard.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// respondConditional responds with a result in the negotiated format,
+// unless the client already has the current version. hash identifies the
+// content of the result, so it is only encoded if it must be sent.
+func respondConditional(c *gin.Context, hash string, v interface{}, lastUpdated string) {
+	f := negotiateFormat(c)
+
+	c.Writer.Header().Add("Vary", "Accept")
+
+	if notModified(c, contentETag([]byte(hash), []byte(f.name)), parseLastUpdated(lastUpdated)) {
+		return
+	}
+
+	data, err := f.encode(v)
+	if err != nil {
+		c.Error(err)
+		render(c, http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+
+	c.Data(http.StatusOK, f.contentType(), data)
+}
+
+// noStore marks responses as never cacheable.
+func noStore(c *gin.Context) {
+	c.Writer.Header().Set("Cache-Control", "no-store")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/syfaro/mcapi/types"
+)
+
+func TestConditionalStatus(t *testing.T) {
+	router := fieldsRouter()
+
+	request := func(path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		return w
+	}
+
+	first := request("/server/status?ip=example.com")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected an ETag, got %d", first.Code)
+	}
+
+	if cc := first.Header().Get("Cache-Control"); !strings.HasPrefix(cc, "max-age=") {
+		t.Errorf("expected the result to be cacheable, got %q", cc)
+	}
+
+	if w := request("/server/status?ip=example.com", "If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for a matching ETag, got %d", w.Code)
+	}
+
+	if w := request("/server/status?ip=example.com", "If-Modified-Since", time.Now().UTC().Format(http.TimeFormat)); w.Code != http.StatusNotModified {
+		t.Errorf("expected 304 when not modified since, got %d", w.Code)
+	}
+
+	for _, other := range []struct{ path, accept string }{
+		{"/server/status?ip=example.com&fields=online", ""},
+		{"/server/status?ip=example.com", "application/cbor"},
+	} {
+		if w := request(other.path, "Accept", other.accept); w.Header().Get("ETag") == etag {
+			t.Errorf("expected a different ETag for %s with Accept %q", other.path, other.accept)
+		}
+	}
+
+	previous, _ := pingMap.GetOK("example.com:25565")
+	updated := *previous.(*types.ServerStatus)
+	updated.Players.Now = 4
+	pingMap.Set("example.com:25565", &updated)
+
+	if w := request("/server/status?ip=example.com", "If-None-Match", etag); w.Code != http.StatusOK {
+		t.Errorf("expected the changed result to be sent, got %d", w.Code)
+	}
+}
+
+func TestErrorsNotStored(t *testing.T) {
+	router := fieldsRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/server/status", nil))
+
+	if w.Code != http.StatusBadRequest || w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("expected an uncacheable error, got %d with %q", w.Code, w.Header().Get("Cache-Control"))
+	}
+}
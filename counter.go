@@ -0,0 +1,54 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// counter is a shared count, such as the number of requests served.
+type counter interface {
+	incr() error
+	get() (int64, error)
+}
+
+var requestCounter counter
+
+// redisCounter is a counter stored in a Redis key, shared by every instance.
+type redisCounter struct {
+	pool *redis.Pool
+	key  string
+}
+
+func (r *redisCounter) incr() error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("INCR", r.key)
+	return err
+}
+
+func (r *redisCounter) get() (int64, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	return redis.Int64(conn.Do("GET", r.key))
+}
+
+// memoryCounter is a counter kept in process.
+type memoryCounter struct {
+	value int64
+}
+
+func (m *memoryCounter) incr() error {
+	atomic.AddInt64(&m.value, 1)
+	return nil
+}
+
+func (m *memoryCounter) get() (int64, error) {
+	return atomic.LoadInt64(&m.value), nil
+}
+
+func (m *memoryCounter) set(value int64) {
+	atomic.StoreInt64(&m.value, value)
+}
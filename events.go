@@ -0,0 +1,257 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/syfaro/mcapi/types"
+)
+
+const (
+	eventStatus = "status"
+	eventQuery  = "query"
+)
+
+// serverEvent is published when a refresh changes something about a server.
+type serverEvent struct {
+	Kind    string              `json:"kind"`
+	Address string              `json:"address"`
+	Changes []string            `json:"changes"`
+	Status  *types.ServerStatus `json:"status,omitempty"`
+	Query   *types.ServerQuery  `json:"query,omitempty"`
+
+	// PreviousStatus is the status before the refresh, if there was one.
+	PreviousStatus *types.ServerStatus `json:"-"`
+}
+
+// eventHub fans out server events to everyone following those servers,
+// so followers never cause additional pings or queries.
+type eventHub struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[*subscription]bool
+	// listeners receive every event. They must not block.
+	listeners []func(*serverEvent)
+}
+
+// subscription receives events for a set of servers. If its buffer fills
+// because events aren't being read, the channel is closed and no more
+// events are delivered.
+type subscription struct {
+	hub    *eventHub
+	events chan *serverEvent
+
+	mu        sync.Mutex
+	addresses map[string]bool
+	closed    bool
+}
+
+var events = newEventHub()
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subscribers: map[string]map[*subscription]bool{},
+	}
+}
+
+func (h *eventHub) subscribe(buffer int, addresses ...string) *subscription {
+	sub := &subscription{
+		hub:       h,
+		events:    make(chan *serverEvent, buffer),
+		addresses: map[string]bool{},
+	}
+
+	for _, address := range addresses {
+		sub.add(address)
+	}
+
+	return sub
+}
+
+// listen calls fn for every event on every server.
+func (h *eventHub) listen(fn func(*serverEvent)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.listeners = append(h.listeners, fn)
+}
+
+func (h *eventHub) publish(event *serverEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subscribers[event.Address] {
+		sub.send(event)
+	}
+
+	for _, fn := range h.listeners {
+		fn(event)
+	}
+}
+
+// add starts delivering events for a server.
+func (s *subscription) add(address string) {
+	s.mu.Lock()
+	s.addresses[address] = true
+	s.mu.Unlock()
+
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	if s.hub.subscribers[address] == nil {
+		s.hub.subscribers[address] = map[*subscription]bool{}
+	}
+
+	s.hub.subscribers[address][s] = true
+}
+
+// remove stops delivering events for a server.
+func (s *subscription) remove(address string) {
+	s.mu.Lock()
+	delete(s.addresses, address)
+	s.mu.Unlock()
+
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	s.hub.unsubscribe(address, s)
+}
+
+// count returns the number of servers being followed.
+func (s *subscription) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.addresses)
+}
+
+// close stops all events and closes the channel, if it is not already.
+func (s *subscription) close() {
+	s.mu.Lock()
+	addresses := s.addresses
+	s.addresses = map[string]bool{}
+
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	s.mu.Unlock()
+
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	for address := range addresses {
+		s.hub.unsubscribe(address, s)
+	}
+}
+
+func (s *subscription) send(event *serverEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.events <- event:
+	default:
+		s.closed = true
+		close(s.events)
+	}
+}
+
+// unsubscribe must be called with the hub's lock held.
+func (h *eventHub) unsubscribe(address string, sub *subscription) {
+	delete(h.subscribers[address], sub)
+
+	if len(h.subscribers[address]) == 0 {
+		delete(h.subscribers, address)
+	}
+}
+
+// publishStatus publishes an event if a refresh changed whether a server
+// is online, its player count, MOTD or version.
+func publishStatus(address string, previous interface{}, status *types.ServerStatus) {
+	var changes []string
+
+	prev, ok := previous.(*types.ServerStatus)
+	if ok {
+		if prev.Online != status.Online {
+			changes = append(changes, "online")
+		}
+		if prev.Players != status.Players {
+			changes = append(changes, "players")
+		}
+		if prev.Motd != status.Motd {
+			changes = append(changes, "motd")
+		}
+		if prev.Server != status.Server {
+			changes = append(changes, "version")
+		}
+	} else {
+		changes = []string{"online", "players", "motd", "version"}
+	}
+
+	if len(changes) == 0 {
+		return
+	}
+
+	events.publish(&serverEvent{
+		Kind:           eventStatus,
+		Address:        address,
+		Changes:        changes,
+		Status:         status,
+		PreviousStatus: prev,
+	})
+}
+
+// publishQuery publishes an event if a refresh changed whether a server
+// is online, its players, MOTD, version or plugins.
+func publishQuery(address string, previous interface{}, query *types.ServerQuery) {
+	var changes []string
+
+	if prev, ok := previous.(*types.ServerQuery); ok {
+		if prev.Online != query.Online {
+			changes = append(changes, "online")
+		}
+		if prev.Players.Now != query.Players.Now || prev.Players.Max != query.Players.Max ||
+			!equalStrings(prev.Players.List, query.Players.List) {
+			changes = append(changes, "players")
+		}
+		if prev.Motd != query.Motd {
+			changes = append(changes, "motd")
+		}
+		if prev.Version != query.Version || prev.ServerMod != query.ServerMod {
+			changes = append(changes, "version")
+		}
+		if !equalStrings(prev.Plugins, query.Plugins) {
+			changes = append(changes, "plugins")
+		}
+	} else {
+		changes = []string{"online", "players", "motd", "version", "plugins"}
+	}
+
+	if len(changes) == 0 {
+		return
+	}
+
+	events.publish(&serverEvent{
+		Kind:    eventQuery,
+		Address: address,
+		Changes: changes,
+		Query:   query,
+	})
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
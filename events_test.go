@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/syfaro/mcapi/types"
+)
+
+func TestEventFanOut(t *testing.T) {
+	hub := newEventHub()
+
+	a := hub.subscribe(4, "example.com:25565")
+	b := hub.subscribe(4, "example.com:25565", "other.example.com:25565")
+	defer a.close()
+	defer b.close()
+
+	var heard int
+	hub.listen(func(*serverEvent) { heard++ })
+
+	hub.publish(&serverEvent{Kind: eventStatus, Address: "example.com:25565"})
+	hub.publish(&serverEvent{Kind: eventStatus, Address: "other.example.com:25565"})
+
+	if len(a.events) != 1 || len(b.events) != 2 {
+		t.Errorf("expected events only for followed servers, got %d and %d", len(a.events), len(b.events))
+	}
+
+	if heard != 2 {
+		t.Errorf("expected listeners to hear every event, got %d", heard)
+	}
+
+	b.remove("example.com:25565")
+	hub.publish(&serverEvent{Kind: eventStatus, Address: "example.com:25565"})
+
+	if len(a.events) != 2 || len(b.events) != 2 {
+		t.Errorf("expected removed servers to stop delivering, got %d and %d", len(a.events), len(b.events))
+	}
+
+	a.close()
+	b.close()
+
+	if len(hub.subscribers) != 0 {
+		t.Errorf("expected closed subscriptions to be removed, got %v", hub.subscribers)
+	}
+}
+
+func TestEventSlowSubscriber(t *testing.T) {
+	hub := newEventHub()
+
+	slow := hub.subscribe(1, "example.com:25565")
+	defer slow.close()
+
+	hub.publish(&serverEvent{Kind: eventStatus, Address: "example.com:25565"})
+	hub.publish(&serverEvent{Kind: eventStatus, Address: "example.com:25565"})
+
+	if _, ok := <-slow.events; !ok {
+		t.Fatal("expected the first event to be delivered")
+	}
+
+	if _, ok := <-slow.events; ok {
+		t.Error("expected a full subscription to be closed")
+	}
+
+	// Publishing after the subscription was closed must not panic.
+	hub.publish(&serverEvent{Kind: eventStatus, Address: "example.com:25565"})
+}
+
+func TestPublishStatusChanges(t *testing.T) {
+	previous := events
+	events = newEventHub()
+	defer func() { events = previous }()
+
+	sub := events.subscribe(4, "example.com:25565")
+	defer sub.close()
+
+	old := &types.ServerStatus{Online: true, Motd: "hello", Players: types.ServerStatusPlayers{Max: 20, Now: 1}}
+
+	publishStatus("example.com:25565", old, &types.ServerStatus{Online: true, Motd: "hello", Players: types.ServerStatusPlayers{Max: 20, Now: 1}, LastUpdated: "1"})
+	if len(sub.events) != 0 {
+		t.Error("expected no event when nothing changed")
+	}
+
+	publishStatus("example.com:25565", old, &types.ServerStatus{Online: true, Motd: "hello", Players: types.ServerStatusPlayers{Max: 20, Now: 2}})
+	if event := <-sub.events; len(event.Changes) != 1 || event.Changes[0] != "players" || event.PreviousStatus != old {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	publishStatus("example.com:25565", nil, &types.ServerStatus{})
+	if event := <-sub.events; len(event.Changes) != 4 {
+		t.Errorf("expected every field to change for a new server, got %v", event.Changes)
+	}
+}
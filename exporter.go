@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/syfaro/mcapi/types"
+)
+
+// monitoredServers are the servers exported by /metrics/servers.
+var monitoredServers []string
+
+var (
+	minecraftUpDesc = prometheus.NewDesc("minecraft_up",
+		"Whether the server responded to a ping.", []string{"target"}, nil)
+	minecraftPlayersOnlineDesc = prometheus.NewDesc("minecraft_players_online",
+		"Players online.", []string{"target"}, nil)
+	minecraftPlayersMaxDesc = prometheus.NewDesc("minecraft_players_max",
+		"Most players allowed online.", []string{"target"}, nil)
+	minecraftLatencyDesc = prometheus.NewDesc("minecraft_latency_seconds",
+		"Time taken to ping the server.", []string{"target"}, nil)
+	minecraftVersionDesc = prometheus.NewDesc("minecraft_version_info",
+		"The server's version name and protocol version.", []string{"target", "version", "protocol"}, nil)
+	minecraftPluginsDesc = prometheus.NewDesc("minecraft_plugins",
+		"Plugins the server lists in its query response.", []string{"target"}, nil)
+)
+
+// serverMetrics exports the status of servers, along with the query when
+// one is available.
+type serverMetrics struct {
+	statuses map[string]*types.ServerStatus
+	queries  map[string]*types.ServerQuery
+}
+
+func (m *serverMetrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		minecraftUpDesc, minecraftPlayersOnlineDesc, minecraftPlayersMaxDesc,
+		minecraftLatencyDesc, minecraftVersionDesc, minecraftPluginsDesc,
+	} {
+		ch <- desc
+	}
+}
+
+func (m *serverMetrics) Collect(ch chan<- prometheus.Metric) {
+	for target, status := range m.statuses {
+		if !status.Online || status.Error != "" {
+			ch <- prometheus.MustNewConstMetric(minecraftUpDesc, prometheus.GaugeValue, 0, target)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(minecraftUpDesc, prometheus.GaugeValue, 1, target)
+		ch <- prometheus.MustNewConstMetric(minecraftPlayersOnlineDesc, prometheus.GaugeValue, float64(status.Players.Now), target)
+		ch <- prometheus.MustNewConstMetric(minecraftPlayersMaxDesc, prometheus.GaugeValue, float64(status.Players.Max), target)
+		ch <- prometheus.MustNewConstMetric(minecraftLatencyDesc, prometheus.GaugeValue, time.Duration(status.Duration).Seconds(), target)
+		ch <- prometheus.MustNewConstMetric(minecraftVersionDesc, prometheus.GaugeValue, 1,
+			target, status.Server.Name, strconv.Itoa(status.Server.Protocol))
+	}
+
+	for target, query := range m.queries {
+		if !query.Online || query.Error != "" {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(minecraftPluginsDesc, prometheus.GaugeValue, float64(len(query.Plugins)), target)
+	}
+}
+
+// respondServerMetrics serves the metrics of servers in the Prometheus text
+// format.
+func respondServerMetrics(c *gin.Context, metrics *serverMetrics) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics)
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(c.Writer, c.Request)
+}
+
+// respondProbe serves the metrics of any server given as the target
+// parameter, so Prometheus can scrape it like a blackbox exporter probe.
+// Like other lookups, it is served from the cache and only pings and
+// queries servers which are not cached yet.
+func respondProbe(c *gin.Context) {
+	target, err := parseAddress(c.Query("target"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "%s\n", err)
+		return
+	}
+
+	caller := requester(c)
+
+	if limit, count := shouldRateLimit(c.Request.Context(), caller); limit {
+		abortLookup(c, rateLimitedError(count))
+		return
+	}
+
+	var metrics serverMetrics
+	var misses int
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		metrics.statuses, misses = batchStatus(c.Request.Context(), []string{target})
+	}()
+
+	go func() {
+		defer wg.Done()
+		metrics.queries = batchQuery(c.Request.Context(), []string{target})
+	}()
+
+	wg.Wait()
+
+	// Only a failed ping counts towards the rate limit, as many servers
+	// don't enable query.
+	if status := metrics.statuses[target]; misses > 0 && status.Error != "" {
+		incrRateLimit(caller)
+	}
+
+	respondServerMetrics(c, &metrics)
+}
+
+// respondMonitoredServers serves the metrics of every monitored server from
+// the cache, pinging and querying any which are not cached yet.
+func respondMonitoredServers(c *gin.Context) {
+	var metrics serverMetrics
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		metrics.statuses, _ = batchStatus(c.Request.Context(), monitoredServers)
+	}()
+
+	go func() {
+		defer wg.Done()
+		metrics.queries = batchQuery(c.Request.Context(), monitoredServers)
+	}()
+
+	wg.Wait()
+
+	respondServerMetrics(c, &metrics)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+)
+
+func TestServerMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	online := &types.ServerStatus{Status: "success", Online: true, Duration: 25000000}
+	online.Players.Now = 3
+	online.Players.Max = 20
+	online.Server.Name = "Paper 1.20.4"
+	online.Server.Protocol = 765
+
+	metrics := &serverMetrics{
+		statuses: map[string]*types.ServerStatus{
+			"example.com":         online,
+			"offline.example.com": {Status: "success"},
+		},
+		queries: map[string]*types.ServerQuery{
+			"example.com":         {Status: "success", Online: true, Plugins: []string{"WorldEdit", "Essentials"}},
+			"offline.example.com": {Status: "error", Error: "query was cancelled"},
+		},
+	}
+
+	router := gin.New()
+	router.GET("/metrics/servers", func(c *gin.Context) {
+		respondServerMetrics(c, metrics)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics/servers", nil))
+
+	body := w.Body.String()
+
+	for _, want := range []string{
+		`minecraft_up{target="example.com"} 1`,
+		`minecraft_up{target="offline.example.com"} 0`,
+		`minecraft_players_online{target="example.com"} 3`,
+		`minecraft_players_max{target="example.com"} 20`,
+		`minecraft_latency_seconds{target="example.com"} 0.025`,
+		`minecraft_version_info{protocol="765",target="example.com",version="Paper 1.20.4"} 1`,
+		`minecraft_plugins{target="example.com"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected metrics to include %s", want)
+		}
+	}
+
+	if strings.Contains(body, `minecraft_plugins{target="offline.example.com"}`) {
+		t.Error("expected no plugin count for a failed query")
+	}
+}
+
+func TestProbeFromCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	pingMap = newServerCache(0, 0)
+	pingMap.Set("example.com:25565", &types.ServerStatus{Status: "success", Online: true, LastUpdated: now})
+
+	queryMap = newServerCache(0, 0)
+	queryMap.Set("example.com:25565", &types.ServerQuery{Status: "error", Error: "query was cancelled", LastUpdated: now})
+
+	router := gin.New()
+	router.GET("/probe", respondProbe)
+
+	for i := 0; i < rateLimitThreshold*2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/probe?target=example.com", nil)
+		req.RemoteAddr = "192.0.2.10:1234"
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `minecraft_up{target="example.com:25565"} 1`) {
+			t.Fatalf("expected the cached status, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	if rateLimit.Get("192.0.2.10") != nil {
+		t.Error("expected cached probes not to count towards the rate limit")
+	}
+}
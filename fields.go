@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+)
+
+// batchDefaultExclude are the fields left out of batch responses unless
+// the fields or exclude parameters are given, as favicons are often larger
+// than the rest of the status.
+var batchDefaultExclude = []string{"favicon"}
+
+// fieldSelection is which fields of a result to respond with, from the
+// fields and exclude parameters. Nested fields are named with dots, like
+// players.now.
+type fieldSelection struct {
+	fields  []string
+	exclude []string
+}
+
+// splitFields reads a parameter which may be repeated or comma separated.
+func splitFields(values []string) []string {
+	var fields []string
+
+	for _, value := range values {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				fields = append(fields, field)
+			}
+		}
+	}
+
+	return fields
+}
+
+// requestFields reads the fields and exclude parameters. If neither is
+// given, defaultExclude is used.
+func requestFields(c *gin.Context, defaultExclude ...string) *fieldSelection {
+	query := c.Request.URL.Query()
+
+	sel := &fieldSelection{
+		fields: splitFields(query["fields"]),
+	}
+
+	if exclude, ok := query["exclude"]; ok {
+		sel.exclude = splitFields(exclude)
+	} else if len(sel.fields) == 0 {
+		sel.exclude = defaultExclude
+	}
+
+	return sel
+}
+
+func (sel *fieldSelection) empty() bool {
+	return sel.fields == nil && len(sel.exclude) == 0
+}
+
+// knownFields holds the fields which may be selected from each type of
+// result, including objects containing other fields.
+var knownFields sync.Map
+
+// selectableFields returns the fields which may be selected from v, from
+// its schema. It returns nil if v has no schema.
+func selectableFields(v interface{}) map[string]bool {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if known, ok := knownFields.Load(t); ok {
+		return known.(map[string]bool)
+	}
+
+	var known map[string]bool
+
+	for _, field := range openAPISpec.schemaFields(schemaName(t)) {
+		if known == nil {
+			known = map[string]bool{}
+		}
+
+		parts := strings.Split(field.Name, ".")
+		for i := range parts {
+			known[strings.Join(parts[:i+1], ".")] = true
+		}
+	}
+
+	knownFields.Store(t, known)
+
+	return known
+}
+
+// canonicalFields removes unknown and repeated fields and sorts the rest.
+func canonicalFields(fields []string, known map[string]bool) []string {
+	canonical := []string{}
+
+	for _, field := range fields {
+		if known[field] {
+			canonical = append(canonical, field)
+		}
+	}
+
+	sort.Strings(canonical)
+
+	deduped := canonical[:0]
+	for i, field := range canonical {
+		if i == 0 || field != canonical[i-1] {
+			deduped = append(deduped, field)
+		}
+	}
+
+	return deduped
+}
+
+// canonical returns the selection with only the fields v has, sorted and
+// without repeats, so equivalent selections share one trimmed form.
+func (sel *fieldSelection) canonical(v interface{}) *fieldSelection {
+	known := selectableFields(v)
+	if known == nil {
+		return sel
+	}
+
+	canonical := &fieldSelection{}
+
+	// Selecting only unknown fields still selects nothing, rather than
+	// everything.
+	if sel.fields != nil {
+		canonical.fields = canonicalFields(sel.fields, known)
+	}
+
+	if exclude := canonicalFields(sel.exclude, known); len(exclude) > 0 {
+		canonical.exclude = exclude
+	}
+
+	return canonical
+}
+
+// form identifies the selection, for caching trimmed results.
+func (sel *fieldSelection) form() string {
+	form := "exclude=" + strings.Join(sel.exclude, ",")
+	if sel.fields != nil {
+		form = "fields=" + strings.Join(sel.fields, ",") + "&" + form
+	}
+
+	return form
+}
+
+// trim encodes v with only the selected fields.
+func (sel *fieldSelection) trim(v interface{}) (json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+
+	if sel.fields != nil {
+		selected := map[string]interface{}{}
+		for _, field := range sel.fields {
+			copyField(selected, obj, strings.Split(field, "."))
+		}
+
+		obj = selected
+	}
+
+	for _, field := range sel.exclude {
+		deleteField(obj, strings.Split(field, "."))
+	}
+
+	return json.Marshal(obj)
+}
+
+func copyField(dst, src map[string]interface{}, path []string) {
+	value, ok := src[path[0]]
+	if !ok {
+		return
+	}
+
+	if len(path) == 1 {
+		dst[path[0]] = value
+		return
+	}
+
+	nested, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	child, ok := dst[path[0]].(map[string]interface{})
+	if !ok {
+		child = map[string]interface{}{}
+		dst[path[0]] = child
+	}
+
+	copyField(child, nested, path[1:])
+}
+
+func deleteField(obj map[string]interface{}, path []string) {
+	if len(path) == 1 {
+		delete(obj, path[0])
+		return
+	}
+
+	if nested, ok := obj[path[0]].(map[string]interface{}); ok {
+		deleteField(nested, path[1:])
+	}
+}
+
+// trimmed returns the selected fields of a cached result, which is encoded
+// once for each selection. The encoded form of a result is named by version,
+// as v1 and v2 results are encoded differently from the same cached value.
+func (sel *fieldSelection) trimmed(cache *serverCache, serverAddr, version string, cached, v interface{}) (json.RawMessage, error) {
+	sel = sel.canonical(v)
+
+	return cache.Trimmed(serverAddr, version+"?"+sel.form(), cached, func() (json.RawMessage, error) {
+		return sel.trim(v)
+	})
+}
+
+// trimmedBatch is a v1 batch response with fields removed from each server.
+type trimmedBatch struct {
+	Status  string                     `json:"status"`
+	Servers map[string]json.RawMessage `json:"servers"`
+}
+
+// trimmedBatchV2 is a v2 batch response with fields removed from each server.
+type trimmedBatchV2 struct {
+	Servers map[string]json.RawMessage `json:"servers"`
+	Errors  map[string]*types.ErrorV2  `json:"errors"`
+}
+
+// respondSelected responds with the selected fields of a cached result,
+// unless the client already has the current version. v is the response
+// for the cached value.
+func respondSelected(c *gin.Context, cache *serverCache, serverAddr, version string, cached, v interface{}, lastUpdated string) {
+	sel := requestFields(c).canonical(v)
+
+	hash, err := cache.Hash(serverAddr, cached)
+	if err != nil {
+		c.Error(err)
+		render(c, http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+
+	// The same value gives different responses for each version and
+	// selection of fields.
+	hash += version + "?" + sel.form()
+
+	if sel.empty() {
+		respondConditional(c, hash, v, lastUpdated)
+		return
+	}
+
+	data, err := sel.trimmed(cache, serverAddr, version, cached, v)
+	if err != nil {
+		c.Error(err)
+		render(c, http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+
+	respondConditional(c, hash, data, lastUpdated)
+}
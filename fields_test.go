@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+)
+
+func fieldsRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	pingMap = newServerCache(0, 0)
+	pingMap.Set("example.com:25565", &types.ServerStatus{
+		Status:      "success",
+		Online:      true,
+		Motd:        "A Minecraft Server",
+		Favicon:     testFavicon,
+		Players:     types.ServerStatusPlayers{Max: 20, Now: 3},
+		LastUpdated: now,
+		LastOnline:  now,
+	})
+
+	router := gin.New()
+	router.GET("/server/status", respondServerStatus)
+	router.GET("/server/status/batch", respondServerStatusBatch)
+
+	return router
+}
+
+func getJSON(t *testing.T, router *gin.Engine, path string) map[string]interface{} {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	return resp
+}
+
+func TestStatusFields(t *testing.T) {
+	router := fieldsRouter()
+
+	resp := getJSON(t, router, "/server/status?ip=example.com&fields=online,players.now")
+	if len(resp) != 2 || resp["online"] != true {
+		t.Errorf("unexpected fields %v", resp)
+	}
+
+	if players, _ := resp["players"].(map[string]interface{}); len(players) != 1 || players["now"] != 3.0 {
+		t.Errorf("unexpected players %v", resp["players"])
+	}
+
+	resp = getJSON(t, router, "/server/status?ip=example.com&exclude=favicon,players.max")
+	if _, ok := resp["favicon"]; ok {
+		t.Error("favicon was not excluded")
+	}
+
+	if players, _ := resp["players"].(map[string]interface{}); len(players) != 1 {
+		t.Errorf("unexpected players %v", resp["players"])
+	}
+
+	resp = getJSON(t, router, "/server/status?ip=example.com")
+	if resp["favicon"] != testFavicon {
+		t.Error("favicon was excluded without being requested")
+	}
+}
+
+func TestBatchExcludesFavicon(t *testing.T) {
+	router := fieldsRouter()
+
+	server := func(resp map[string]interface{}) map[string]interface{} {
+		servers, _ := resp["servers"].(map[string]interface{})
+		status, _ := servers["example.com:25565"].(map[string]interface{})
+		return status
+	}
+
+	status := server(getJSON(t, router, "/server/status/batch?address=example.com"))
+	if _, ok := status["favicon"]; ok || status["motd"] != "A Minecraft Server" {
+		t.Errorf("unexpected status %v", status)
+	}
+
+	status = server(getJSON(t, router, "/server/status/batch?address=example.com&exclude="))
+	if status["favicon"] != testFavicon {
+		t.Error("favicon was excluded after being requested")
+	}
+}
+
+func TestTrimmedCached(t *testing.T) {
+	cache := newServerCache(0, 0)
+	status := &types.ServerStatus{Online: true, Motd: "cached"}
+	cache.Set("example.com:25565", status)
+
+	calls := 0
+	trim := func() (json.RawMessage, error) {
+		calls++
+		return json.RawMessage(`{"online":true}`), nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Trimmed("example.com:25565", "online", status, trim); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("expected the trimmed form to be created once, got %d", calls)
+	}
+
+	cache.Set("example.com:25565", &types.ServerStatus{Online: false})
+
+	if _, err := cache.Trimmed("example.com:25565", "online", status, trim); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 2 {
+		t.Errorf("expected the trimmed form to be discarded on update, got %d calls", calls)
+	}
+}
+
+func TestCanonicalFields(t *testing.T) {
+	status := &types.ServerStatus{}
+
+	tests := []struct {
+		fields, exclude []string
+		want            string
+	}{
+		{[]string{"players.now", "online", "online", "unknown"}, nil, "fields=online,players.now&exclude="},
+		{[]string{"online", "players.now"}, nil, "fields=online,players.now&exclude="},
+		{[]string{"unknown"}, nil, "fields=&exclude="},
+		{nil, []string{"favicon", "unknown", "favicon"}, "exclude=favicon"},
+		{nil, []string{"unknown"}, "exclude="},
+		{[]string{"players"}, []string{"players.max"}, "fields=players&exclude=players.max"},
+	}
+
+	for _, test := range tests {
+		sel := (&fieldSelection{fields: test.fields, exclude: test.exclude}).canonical(status)
+
+		if form := sel.form(); form != test.want {
+			t.Errorf("%v %v: expected %s, got %s", test.fields, test.exclude, test.want, form)
+		}
+	}
+
+	router := fieldsRouter()
+
+	if resp := getJSON(t, router, "/server/status?ip=example.com&fields=unknown"); len(resp) != 0 {
+		t.Errorf("expected no fields, got %v", resp)
+	}
+
+	if resp := getJSON(t, router, "/server/status?ip=example.com&exclude=unknown"); resp["favicon"] != testFavicon {
+		t.Errorf("expected every field, got %v", resp)
+	}
+}
+
+func TestTrimmedFormsLimited(t *testing.T) {
+	cache := newServerCache(0, 0)
+	status := &types.ServerStatus{Online: true}
+	cache.Set("example.com:25565", status)
+
+	for i := 0; i < maxTrimmedForms*2; i++ {
+		form := strconv.Itoa(i)
+		if _, err := cache.Trimmed("example.com:25565", form, status, func() (json.RawMessage, error) {
+			return json.RawMessage(`{}`), nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entry := cache.entries["example.com:25565"].Value.(*cacheEntry)
+	if len(entry.trimmed) != maxTrimmedForms {
+		t.Errorf("expected %d trimmed forms to be kept, got %d", maxTrimmedForms, len(entry.trimmed))
+	}
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v2"
+)
+
+// outputFormat is a way of serialising responses. All formats use the
+// same field names as the JSON responses.
+type outputFormat struct {
+	// name is the value of the format parameter which selects this format.
+	name string
+	// contentTypes are the media types matched against the Accept header,
+	// the first of which is used in responses.
+	contentTypes []string
+	encode       func(v interface{}) ([]byte, error)
+}
+
+var jsonFormat = &outputFormat{
+	name:         "json",
+	contentTypes: []string{"application/json"},
+	encode:       json.Marshal,
+}
+
+var outputFormats = []*outputFormat{
+	jsonFormat,
+	{
+		name:         "msgpack",
+		contentTypes: []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"},
+		encode:       encodeGeneric(encodeMsgpack),
+	},
+	{
+		name:         "cbor",
+		contentTypes: []string{"application/cbor"},
+		encode:       encodeGeneric(encodeCBOR),
+	},
+	{
+		name:         "xml",
+		contentTypes: []string{"application/xml", "text/xml"},
+		encode:       encodeGeneric(encodeXML),
+	},
+	{
+		name:         "yaml",
+		contentTypes: []string{"application/yaml", "application/x-yaml", "text/yaml"},
+		encode:       encodeGeneric(yaml.Marshal),
+	},
+	{
+		name:         "text",
+		contentTypes: []string{"text/plain"},
+		encode:       encodeGeneric(encodeText),
+	},
+}
+
+func (f *outputFormat) contentType() string {
+	if strings.HasPrefix(f.contentTypes[0], "text/") || f == jsonFormat {
+		return f.contentTypes[0] + "; charset=utf-8"
+	}
+
+	return f.contentTypes[0]
+}
+
+// acceptedTypes returns the media types listed in an Accept header which
+// have the highest quality. Wildcards are left out, as they don't prefer
+// any format.
+func acceptedTypes(header string) []string {
+	var preferred []string
+	best := 0.0
+
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" || strings.HasSuffix(mediaType, "/*") {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || strings.TrimSpace(key) != "q" {
+				continue
+			}
+
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				parsed = 0
+			}
+
+			q = parsed
+		}
+
+		switch {
+		case q <= 0 || q < best:
+		case q > best:
+			best, preferred = q, []string{mediaType}
+		default:
+			preferred = append(preferred, mediaType)
+		}
+	}
+
+	return preferred
+}
+
+// negotiateFormat picks the format for a response, from the format
+// parameter if given or otherwise the Accept header. Another format is only
+// used over JSON if it is one of the most preferred types, so browsers,
+// which prefer HTML, get JSON.
+func negotiateFormat(c *gin.Context) *outputFormat {
+	if name := c.Query("format"); name != "" {
+		for _, f := range outputFormats {
+			if f.name == name {
+				return f
+			}
+		}
+
+		return jsonFormat
+	}
+
+	accepted := acceptedTypes(c.GetHeader("Accept"))
+
+	for _, f := range outputFormats {
+		for _, contentType := range f.contentTypes {
+			for _, mediaType := range accepted {
+				if contentType == mediaType {
+					return f
+				}
+			}
+		}
+	}
+
+	return jsonFormat
+}
+
+// render responds with v in the negotiated format.
+func render(c *gin.Context, code int, v interface{}) {
+	f := negotiateFormat(c)
+
+	data, err := f.encode(v)
+	if err != nil {
+		c.Error(err)
+		f, data = jsonFormat, []byte(`{"error":"internal server error"}`)
+		code = http.StatusInternalServerError
+	}
+
+	// Errors may be temporary, so they are never cached.
+	if code >= http.StatusBadRequest {
+		c.Writer.Header().Set("Cache-Control", "no-store")
+	}
+
+	c.Writer.Header().Add("Vary", "Accept")
+	c.Data(code, f.contentType(), data)
+}
+
+// abortRender stops the handler chain and responds with v in the
+// negotiated format.
+func abortRender(c *gin.Context, code int, v interface{}) {
+	c.Abort()
+	render(c, code, v)
+}
+
+// encodeGeneric converts v into maps, slices and scalars with the same
+// structure as its JSON encoding before passing it to encode.
+func encodeGeneric(encode func(v interface{}) ([]byte, error)) func(v interface{}) ([]byte, error) {
+	return func(v interface{}) ([]byte, error) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+
+		var generic interface{}
+		if err := dec.Decode(&generic); err != nil {
+			return nil, err
+		}
+
+		return encode(normalizeNumbers(generic))
+	}
+}
+
+// normalizeNumbers replaces JSON numbers with integers where possible,
+// and floats otherwise.
+func normalizeNumbers(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = normalizeNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = normalizeNumbers(item)
+		}
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := val.Float64()
+		return f
+	}
+
+	return v
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func scalarString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	}
+
+	return fmt.Sprint(v)
+}
+
+// encodeMsgpack and encodeCBOR sort map keys, as the other formats do,
+// so that the ETag of a response is stable.
+func encodeMsgpack(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	enc := msgpack.NewEncoder(buf)
+	enc.SetSortMapKeys(true)
+	enc.UseCompactInts(true)
+
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+var cborEncMode, _ = cbor.EncOptions{Sort: cbor.SortCanonical}.EncMode()
+
+func encodeCBOR(v interface{}) ([]byte, error) {
+	return cborEncMode.Marshal(v)
+}
+
+func encodeXML(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(buf)
+
+	if err := writeXMLValue(enc, xml.StartElement{Name: xml.Name{Local: "response"}}, v); err != nil {
+		return nil, err
+	}
+
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeXMLValue writes objects as elements named after their keys, and
+// arrays as repeated item elements. Keys which aren't valid element names,
+// such as server addresses, are written as item elements with a key attribute.
+func writeXMLValue(enc *xml.Encoder, start xml.StartElement, v interface{}) error {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+
+		for _, k := range sortedKeys(val) {
+			child := xml.StartElement{Name: xml.Name{Local: k}}
+			if !validXMLName(k) {
+				child = xml.StartElement{
+					Name: xml.Name{Local: "item"},
+					Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: k}},
+				}
+			}
+
+			if err := writeXMLValue(enc, child, val[k]); err != nil {
+				return err
+			}
+		}
+
+		return enc.EncodeToken(start.End())
+	case []interface{}:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+
+		for _, item := range val {
+			if err := writeXMLValue(enc, xml.StartElement{Name: xml.Name{Local: "item"}}, item); err != nil {
+				return err
+			}
+		}
+
+		return enc.EncodeToken(start.End())
+	}
+
+	return enc.EncodeElement(scalarString(v), start)
+}
+
+func validXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+
+	for i, r := range name {
+		switch {
+		case r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+		case i > 0 && (r == '-' || r == '.' || (r >= '0' && r <= '9')):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// encodeText writes one "key: value" line for each value, with nested
+// keys joined by dots, so responses are easy to use from shell scripts.
+func encodeText(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	writeTextValue(buf, "", v)
+
+	return buf.Bytes(), nil
+}
+
+func writeTextValue(buf *bytes.Buffer, key string, v interface{}) {
+	prefix := key
+	if prefix != "" {
+		prefix += "."
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(val) {
+			writeTextValue(buf, prefix+k, val[k])
+		}
+	case []interface{}:
+		for i, item := range val {
+			writeTextValue(buf, prefix+strconv.Itoa(i), item)
+		}
+	default:
+		value := strings.NewReplacer("\r", `\r`, "\n", `\n`).Replace(scalarString(v))
+
+		buf.WriteString(key)
+		buf.WriteString(": ")
+		buf.WriteString(value)
+		buf.WriteString("\n")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v2"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		query  string
+		accept string
+		want   string
+	}{
+		{"", "", "json"},
+		{"", "*/*", "json"},
+		{"", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "json"},
+		{"", "application/msgpack", "msgpack"},
+		{"", "application/json;q=0.5, application/cbor", "cbor"},
+		{"", "application/cbor;q=0.5, application/json", "json"},
+		{"", "application/yaml, application/json", "json"},
+		{"", "text/yaml;q=0.8, text/html;q=0.5, */*;q=0.1", "yaml"},
+		{"", "application/xml;q=0", "json"},
+		{"", "TEXT/PLAIN; charset=utf-8", "text"},
+		{"format=xml", "application/json", "xml"},
+		{"format=unknown", "application/cbor", "json"},
+	}
+
+	for _, test := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/?"+test.query, nil)
+		c.Request.Header.Set("Accept", test.accept)
+
+		if got := negotiateFormat(c); got.name != test.want {
+			t.Errorf("%q with Accept %q: expected %s, got %s", test.query, test.accept, test.want, got.name)
+		}
+	}
+}
+
+var formatTestValue = map[string]interface{}{
+	"online": true,
+	"motd":   "line one\nline two",
+	"players": map[string]interface{}{
+		"max":  20,
+		"list": []string{"Notch", "jeb_"},
+	},
+	"servers": map[string]interface{}{
+		"example.com:25565": 1.5,
+	},
+}
+
+func formatByName(name string) *outputFormat {
+	for _, f := range outputFormats {
+		if f.name == name {
+			return f
+		}
+	}
+
+	return nil
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	decoders := map[string]func([]byte, interface{}) error{
+		"msgpack": msgpack.Unmarshal,
+		"cbor":    cbor.Unmarshal,
+		"yaml":    yaml.Unmarshal,
+	}
+
+	for name, decode := range decoders {
+		data, err := formatByName(name).encode(formatTestValue)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		var resp struct {
+			Online  bool   `msgpack:"online" cbor:"online" yaml:"online"`
+			Motd    string `msgpack:"motd" cbor:"motd" yaml:"motd"`
+			Players struct {
+				Max  int      `msgpack:"max" cbor:"max" yaml:"max"`
+				List []string `msgpack:"list" cbor:"list" yaml:"list"`
+			} `msgpack:"players" cbor:"players" yaml:"players"`
+			Servers map[string]float64 `msgpack:"servers" cbor:"servers" yaml:"servers"`
+		}
+		if err := decode(data, &resp); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if !resp.Online || resp.Motd != "line one\nline two" || resp.Players.Max != 20 ||
+			len(resp.Players.List) != 2 || resp.Servers["example.com:25565"] != 1.5 {
+			t.Errorf("%s: unexpected round trip %+v", name, resp)
+		}
+
+		again, _ := formatByName(name).encode(formatTestValue)
+		if string(again) != string(data) {
+			t.Errorf("%s: expected encoding to be stable", name)
+		}
+	}
+}
+
+func TestFormatXML(t *testing.T) {
+	data, err := formatByName("xml").encode(formatTestValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"<response>",
+		"<online>true</online>",
+		"<players><list><item>Notch</item><item>jeb_</item></list><max>20</max></players>",
+		`<servers><item key="example.com:25565">1.5</item></servers>`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected %s in %s", want, data)
+		}
+	}
+}
+
+func TestFormatText(t *testing.T) {
+	data, err := formatByName("text").encode(formatTestValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `motd: line one\nline two
+online: true
+players.list.0: Notch
+players.list.1: jeb_
+players.max: 20
+servers.example.com:25565: 1.5
+`
+
+	if string(data) != want {
+		t.Errorf("unexpected text output:\n%s", data)
+	}
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/syfaro/mcapi/types"
+)
+
+const (
+	// graphqlMaxComplexity is the most expensive query which may be run.
+	graphqlMaxComplexity = 1000
+	// graphqlComplexityPerRequest is how much complexity counts as one
+	// request towards the rate limit.
+	graphqlComplexityPerRequest = 100
+)
+
+// graphqlFieldCosts are the complexity of fields which look up a server,
+// every other field costs one.
+var graphqlFieldCosts = map[string]int{
+	"status":  5,
+	"query":   10,
+	"history": 5,
+	"uptime":  5,
+}
+
+type graphqlContextKey struct{}
+
+// graphqlServer is the source of the Server type, which resolves each of
+// its fields separately so only what is requested is looked up.
+type graphqlServer struct {
+	Address string `json:"address"`
+}
+
+type graphqlRequest struct {
+	Query         string                 `json:"query" form:"query"`
+	OperationName string                 `json:"operationName" form:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+var graphqlPlayersType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Players",
+	Description: "The number of players on a server. The list is only available from a query.",
+	Fields: graphql.Fields{
+		"max":  &graphql.Field{Type: graphql.Int},
+		"now":  &graphql.Field{Type: graphql.Int},
+		"list": &graphql.Field{Type: graphql.NewList(graphql.String)},
+	},
+})
+
+var graphqlStatusType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Status",
+	Description: "The result of pinging a server.",
+	Fields: graphql.Fields{
+		"online":        &graphql.Field{Type: graphql.Boolean},
+		"motd":          &graphql.Field{Type: graphql.String},
+		"motdFormatted": &graphql.Field{Type: graphql.String},
+		"favicon":       &graphql.Field{Type: graphql.String},
+		"players":       &graphql.Field{Type: graphqlPlayersType},
+		"version": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*types.ServerStatusV2).Server.Name, nil
+			},
+		},
+		"protocol": &graphql.Field{
+			Type: graphql.Int,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*types.ServerStatusV2).Server.Protocol, nil
+			},
+		},
+		"lastOnline":  &graphql.Field{Type: graphql.DateTime},
+		"lastUpdated": &graphql.Field{Type: graphql.DateTime},
+		"durationMs":  &graphql.Field{Type: graphql.Float},
+	},
+})
+
+var graphqlQueryType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Query",
+	Description: "The result of querying a server, which must have query enabled.",
+	Fields: graphql.Fields{
+		"online":      &graphql.Field{Type: graphql.Boolean},
+		"motd":        &graphql.Field{Type: graphql.String},
+		"version":     &graphql.Field{Type: graphql.String},
+		"gameType":    &graphql.Field{Type: graphql.String},
+		"gameId":      &graphql.Field{Type: graphql.String},
+		"serverMod":   &graphql.Field{Type: graphql.String},
+		"map":         &graphql.Field{Type: graphql.String},
+		"players":     &graphql.Field{Type: graphqlPlayersType},
+		"plugins":     &graphql.Field{Type: graphql.NewList(graphql.String)},
+		"lastOnline":  &graphql.Field{Type: graphql.DateTime},
+		"lastUpdated": &graphql.Field{Type: graphql.DateTime},
+		"durationMs":  &graphql.Field{Type: graphql.Float},
+	},
+})
+
+var graphqlHistoryPointType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "HistoryPoint",
+	Description: "The status of a server at one refresh.",
+	Fields: graphql.Fields{
+		"time":    &graphql.Field{Type: graphql.DateTime},
+		"online":  &graphql.Field{Type: graphql.Boolean},
+		"players": &graphql.Field{Type: graphql.Int},
+	},
+})
+
+var graphqlUptimeType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Uptime",
+	Description: "How often a server was online when it was refreshed.",
+	Fields: graphql.Fields{
+		"hours":   &graphql.Field{Type: graphql.Int},
+		"samples": &graphql.Field{Type: graphql.Int},
+		"online":  &graphql.Field{Type: graphql.Int},
+		"ratio":   &graphql.Field{Type: graphql.Float},
+	},
+})
+
+var graphqlHoursArgs = graphql.FieldConfigArgument{
+	"hours": &graphql.ArgumentConfig{
+		Type:         graphql.Int,
+		DefaultValue: 24,
+	},
+}
+
+var graphqlServerType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Server",
+	Description: "A Minecraft server.",
+	Fields: graphql.Fields{
+		"address": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"status": &graphql.Field{
+			Type:    graphqlStatusType,
+			Resolve: resolveGraphQLStatus,
+		},
+		"query": &graphql.Field{
+			Type:    graphqlQueryType,
+			Resolve: resolveGraphQLQuery,
+		},
+		"history": &graphql.Field{
+			Type: graphql.NewList(graphqlHistoryPointType),
+			Args: graphqlHoursArgs,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				serverAddr := p.Source.(*graphqlServer).Address
+				since := time.Now().Add(-time.Duration(graphqlHours(p)) * time.Hour)
+
+				return history.since(serverAddr, since), nil
+			},
+		},
+		"uptime": &graphql.Field{
+			Type: graphqlUptimeType,
+			Args: graphqlHoursArgs,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return history.uptime(p.Source.(*graphqlServer).Address, graphqlHours(p)), nil
+			},
+		},
+	},
+})
+
+var graphqlSchema = newGraphQLSchema(graphql.SchemaConfig{
+	Query: graphql.NewObject(graphql.ObjectConfig{
+		Name: "Root",
+		Fields: graphql.Fields{
+			"server": &graphql.Field{
+				Type: graphqlServerType,
+				Args: graphql.FieldConfigArgument{
+					"address": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					serverAddr, err := parseAddress(p.Args["address"].(string))
+					if err != nil {
+						return nil, err
+					}
+
+					return &graphqlServer{Address: serverAddr}, nil
+				},
+			},
+			"servers": &graphql.Field{
+				Type: graphql.NewList(graphqlServerType),
+				Args: graphql.FieldConfigArgument{
+					"addresses": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					addresses := p.Args["addresses"].([]interface{})
+					if len(addresses) > batchMaxAddresses {
+						return nil, fmt.Errorf("too many addresses, the most allowed is %d", batchMaxAddresses)
+					}
+
+					servers := make([]*graphqlServer, 0, len(addresses))
+					for _, addr := range addresses {
+						serverAddr, err := parseAddress(addr.(string))
+						if err != nil {
+							return nil, fmt.Errorf("%s: %s", addr, err)
+						}
+
+						servers = append(servers, &graphqlServer{Address: serverAddr})
+					}
+
+					return servers, nil
+				},
+			},
+		},
+	}),
+})
+
+func newGraphQLSchema(config graphql.SchemaConfig) graphql.Schema {
+	schema, err := graphql.NewSchema(config)
+	if err != nil {
+		panic(err)
+	}
+
+	return schema
+}
+
+func graphqlHours(p graphql.ResolveParams) int {
+	hours, _ := p.Args["hours"].(int)
+	if hours <= 0 {
+		return 1
+	}
+
+	return hours
+}
+
+func graphqlIP(ctx context.Context) string {
+	ip, _ := ctx.Value(graphqlContextKey{}).(string)
+	return ip
+}
+
+func resolveGraphQLStatus(p graphql.ResolveParams) (interface{}, error) {
+	serverAddr := p.Source.(*graphqlServer).Address
+
+	status, err := lookupStatus(p.Context, serverAddr, graphqlIP(p.Context))
+	if err != nil {
+		return nil, err
+	}
+
+	return status.V2(serverAddr), nil
+}
+
+func resolveGraphQLQuery(p graphql.ResolveParams) (interface{}, error) {
+	serverAddr := p.Source.(*graphqlServer).Address
+
+	query, err := lookupQuery(p.Context, serverAddr, graphqlIP(p.Context))
+	if err != nil {
+		return nil, err
+	}
+
+	return query.V2(serverAddr), nil
+}
+
+// graphqlComplexity estimates the cost of running an operation, counting
+// every field once for each server it is requested for.
+func graphqlComplexity(doc *ast.Document, operationName string, variables map[string]interface{}) int {
+	fragments := map[string]*ast.FragmentDefinition{}
+	var operation *ast.OperationDefinition
+
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operation == nil || (def.Name != nil && def.Name.Value == operationName) {
+				operation = def
+			}
+		}
+	}
+
+	if operation == nil {
+		return 0
+	}
+
+	var cost func(set *ast.SelectionSet, multiplier int) int
+	cost = func(set *ast.SelectionSet, multiplier int) int {
+		if set == nil {
+			return 0
+		}
+
+		total := 0
+
+		for _, selection := range set.Selections {
+			switch selection := selection.(type) {
+			case *ast.Field:
+				fieldCost, ok := graphqlFieldCosts[selection.Name.Value]
+				if !ok {
+					fieldCost = 1
+				}
+
+				total += fieldCost * multiplier
+				total += cost(selection.SelectionSet, multiplier*graphqlListSize(selection, variables))
+			case *ast.InlineFragment:
+				total += cost(selection.SelectionSet, multiplier)
+			case *ast.FragmentSpread:
+				if fragment, ok := fragments[selection.Name.Value]; ok {
+					total += cost(fragment.SelectionSet, multiplier)
+				}
+			}
+		}
+
+		return total
+	}
+
+	return cost(operation.SelectionSet, 1)
+}
+
+// graphqlListSize returns how many servers a field returns.
+func graphqlListSize(field *ast.Field, variables map[string]interface{}) int {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "addresses" {
+			continue
+		}
+
+		switch value := arg.Value.(type) {
+		case *ast.ListValue:
+			return len(value.Values)
+		case *ast.Variable:
+			if list, ok := variables[value.Name.Value].([]interface{}); ok {
+				return len(list)
+			}
+		}
+	}
+
+	return 1
+}
+
+func respondGraphQLErrors(c *gin.Context, code int, errs ...error) {
+	formatted := make([]gqlerrors.FormattedError, 0, len(errs))
+	for _, err := range errs {
+		formatted = append(formatted, gqlerrors.FormatError(err))
+	}
+
+	c.JSON(code, &graphql.Result{
+		Errors: formatted,
+	})
+}
+
+func respondGraphQL(c *gin.Context) {
+	var req graphqlRequest
+
+	if c.Request.Method == http.MethodPost {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondGraphQLErrors(c, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		req.Query = c.Query("query")
+		req.OperationName = c.Query("operationName")
+
+		if variables := c.Query("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				respondGraphQLErrors(c, http.StatusBadRequest, err)
+				return
+			}
+		}
+	}
+
+	if req.Query == "" {
+		respondGraphQLErrors(c, http.StatusBadRequest, errors.New("missing query"))
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{
+			Body: []byte(req.Query),
+			Name: "GraphQL request",
+		}),
+	})
+	if err != nil {
+		respondGraphQLErrors(c, http.StatusBadRequest, err)
+		return
+	}
+
+	validation := graphql.ValidateDocument(&graphqlSchema, doc, nil)
+	if !validation.IsValid {
+		c.JSON(http.StatusBadRequest, &graphql.Result{
+			Errors: validation.Errors,
+		})
+		return
+	}
+
+	complexity := graphqlComplexity(doc, req.OperationName, req.Variables)
+	if complexity > graphqlMaxComplexity {
+		respondGraphQLErrors(c, http.StatusBadRequest, fmt.Errorf(
+			"query complexity %d is over the limit of %d", complexity, graphqlMaxComplexity))
+		return
+	}
+
+	ip := requester(c)
+
+	if limit, count := shouldRateLimit(c.Request.Context(), ip); limit {
+		respondGraphQLErrors(c, http.StatusTooManyRequests, rateLimitedError(count))
+		return
+	}
+
+	// Expensive queries count towards the rate limit like many requests.
+	if requests := complexity / graphqlComplexityPerRequest; requests > 0 {
+		incrRateLimitBy(ip, requests)
+	}
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        graphqlSchema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       context.WithValue(c.Request.Context(), graphqlContextKey{}, ip),
+	})
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, result)
+}
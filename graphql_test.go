@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+func TestGraphQLComplexity(t *testing.T) {
+	tests := []struct {
+		query     string
+		variables map[string]interface{}
+		want      int
+	}{
+		// server, address, status and online.
+		{`{ server(address: "a") { address status { online } } }`, nil, 1 + 1 + 5 + 1},
+		{`{ servers(addresses: ["a", "b", "c"]) { status { online } } }`, nil, 1 + 3*(5+1)},
+		{`query($a: [String!]!) { servers(addresses: $a) { query { motd } } }`, map[string]interface{}{
+			"a": []interface{}{"a", "b"},
+		}, 1 + 2*(10+1)},
+		{`{ servers(addresses: ["a", "b"]) { ...f } } fragment f on Server { uptime { online } }`, nil, 1 + 2*(5+1)},
+		{`query A { server(address: "a") { address } } query B { server(address: "a") { status { online } } }`, nil, 1 + 1},
+	}
+
+	for _, test := range tests {
+		doc, err := parser.Parse(parser.ParseParams{Source: test.query})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := graphqlComplexity(doc, "A", test.variables); got != test.want {
+			t.Errorf("%s: expected complexity %d, got %d", test.query, test.want, got)
+		}
+	}
+}
+
+func postGraphQL(router http.Handler, ip string, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = ip + ":1234"
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestGraphQLComplexityLimit(t *testing.T) {
+	router := fieldsRouter()
+	router.POST("/graphql", respondGraphQL)
+
+	addresses := make([]interface{}, 100)
+	for i := range addresses {
+		addresses[i] = "example.com"
+	}
+
+	w := postGraphQL(router, "192.0.2.30", map[string]interface{}{
+		"query":     `query($a: [String!]!) { servers(addresses: $a) { query { motd } } }`,
+		"variables": map[string]interface{}{"a": addresses},
+	})
+
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "complexity") {
+		t.Errorf("expected the query to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if rateLimit.Get("192.0.2.30") != nil {
+		t.Error("expected a rejected query not to count towards the rate limit")
+	}
+
+	w = postGraphQL(router, "192.0.2.31", map[string]interface{}{
+		"query": `{ server(address: "Example.com") { address status { online players { now } } } }`,
+	})
+
+	var resp struct {
+		Data struct {
+			Server struct {
+				Address string
+				Status  struct {
+					Online  bool
+					Players struct{ Now int }
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusOK || resp.Data.Server.Address != "example.com:25565" ||
+		!resp.Data.Server.Status.Online || resp.Data.Server.Status.Players.Now != 3 {
+		t.Errorf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"github.com/syfaro/mcapi/rpc"
+	"github.com/syfaro/mcapi/types"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcWatchBuffer is how many events may be waiting to be sent before a
+// watch is considered too slow and is ended.
+const grpcWatchBuffer = 64
+
+// grpcCodes maps the v2 error codes to gRPC status codes.
+var grpcCodes = map[types.ErrorCode]codes.Code{
+	types.ErrorMissingAddress: codes.InvalidArgument,
+	types.ErrorInvalidAddress: codes.InvalidArgument,
+	types.ErrorInvalidRequest: codes.InvalidArgument,
+	types.ErrorRateLimited:    codes.ResourceExhausted,
+	types.ErrorUnavailable:    codes.Unavailable,
+	types.ErrorInvalidKey:     codes.Unauthenticated,
+	types.ErrorForbidden:      codes.PermissionDenied,
+}
+
+// grpcAPIKeyHeader is the metadata an API key may be sent in.
+const grpcAPIKeyHeader = "x-api-key"
+
+type grpcKeyContext struct{}
+
+// grpcServer serves the gRPC API using the same cache and lanes as the
+// HTTP API.
+type grpcServer struct {
+	rpc.UnimplementedMcapiServer
+}
+
+// serveGRPC listens for gRPC requests on an address.
+func serveGRPC(addr string) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		panic(err)
+	}
+
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(grpcUnaryAPIKey),
+		grpc.StreamInterceptor(grpcStreamAPIKey),
+	)
+	rpc.RegisterMcapiServer(server, &grpcServer{})
+
+	slog.Info("serving gRPC", "addr", addr)
+
+	if err := server.Serve(listener); err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		panic(err)
+	}
+}
+
+// grpcAPIKey authorizes calls made with an API key, in the same way as
+// checkAPIKey. The method's full name is used as its path, so keys limited
+// to endpoints must include paths such as /mcapi.Mcapi/GetStatus. Calls
+// without a key continue to be limited by IP address.
+func grpcAPIKey(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	secrets := md.Get(grpcAPIKeyHeader)
+	if len(secrets) == 0 || secrets[0] == "" {
+		return ctx, nil
+	}
+
+	key, remaining, err := apiKeys.authorize(secrets[0], method, "", time.Now())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	if remaining >= 0 {
+		grpc.SetHeader(ctx, metadata.Pairs(
+			"x-ratelimit-limit", strconv.Itoa(key.DailyQuota),
+			"x-ratelimit-remaining", strconv.FormatInt(remaining, 10),
+		))
+	}
+
+	return context.WithValue(ctx, grpcKeyContext{}, key.ID), nil
+}
+
+func grpcUnaryAPIKey(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := grpcAPIKey(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// grpcKeyStream is a stream whose context includes the API key used.
+type grpcKeyStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *grpcKeyStream) Context() context.Context {
+	return s.ctx
+}
+
+func grpcStreamAPIKey(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := grpcAPIKey(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &grpcKeyStream{ServerStream: ss, ctx: ctx})
+}
+
+// grpcRequester identifies the caller for rate limiting, like requester.
+func grpcRequester(ctx context.Context) string {
+	if id, ok := ctx.Value(grpcKeyContext{}).(string); ok {
+		return apiKeyRequester + id
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+// grpcError converts a lookup error into a gRPC status.
+func grpcError(err *lookupError) error {
+	code, ok := grpcCodes[err.Code]
+	if !ok {
+		code = codes.Unknown
+	}
+
+	st := status.New(code, err.Message)
+
+	if err.TryAfter > 0 {
+		if detailed, detailErr := st.WithDetails(&errdetails.RetryInfo{
+			RetryDelay: durationpb.New(time.Duration(err.TryAfter) * time.Second),
+		}); detailErr == nil {
+			st = detailed
+		}
+	}
+
+	return st.Err()
+}
+
+func grpcAddress(address string) (string, error) {
+	serverAddr, err := parseAddress(address)
+	if err == errMissingAddress {
+		return "", status.Error(codes.InvalidArgument, "missing server address")
+	} else if err != nil {
+		return "", status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return serverAddr, nil
+}
+
+func grpcTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+
+	return timestamppb.New(*t)
+}
+
+func statusProto(serverAddr string, s *types.ServerStatus) *rpc.ServerStatus {
+	v2 := s.V2(serverAddr)
+
+	return &rpc.ServerStatus{
+		Address:       v2.Address,
+		Online:        v2.Online,
+		Motd:          v2.Motd,
+		MotdFormatted: v2.MotdFormatted,
+		Favicon:       v2.Favicon,
+		Players: &rpc.Players{
+			Max: int32(v2.Players.Max),
+			Now: int32(v2.Players.Now),
+		},
+		Version: &rpc.Version{
+			Name:     v2.Server.Name,
+			Protocol: int32(v2.Server.Protocol),
+		},
+		LastOnline:  grpcTimestamp(v2.LastOnline),
+		LastUpdated: grpcTimestamp(&v2.LastUpdated),
+		DurationMs:  v2.DurationMs,
+	}
+}
+
+func queryProto(serverAddr string, q *types.ServerQuery) *rpc.ServerQuery {
+	v2 := q.V2(serverAddr)
+
+	return &rpc.ServerQuery{
+		Address:   v2.Address,
+		Online:    v2.Online,
+		Motd:      v2.Motd,
+		Version:   v2.Version,
+		GameType:  v2.GameType,
+		GameId:    v2.GameID,
+		ServerMod: v2.ServerMod,
+		Map:       v2.Map,
+		Players: &rpc.Players{
+			Max:  int32(v2.Players.Max),
+			Now:  int32(v2.Players.Now),
+			List: v2.Players.List,
+		},
+		Plugins:     v2.Plugins,
+		LastOnline:  grpcTimestamp(v2.LastOnline),
+		LastUpdated: grpcTimestamp(&v2.LastUpdated),
+		DurationMs:  v2.DurationMs,
+	}
+}
+
+func errorProto(err *lookupError) *rpc.Error {
+	return &rpc.Error{
+		Code:     string(err.Code),
+		Message:  err.Message,
+		TryAfter: int32(err.TryAfter),
+	}
+}
+
+func (s *grpcServer) GetStatus(ctx context.Context, req *rpc.GetStatusRequest) (*rpc.ServerStatus, error) {
+	serverAddr, err := grpcAddress(req.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	st, lookupErr := lookupStatus(ctx, serverAddr, grpcRequester(ctx))
+	if lookupErr != nil {
+		return nil, grpcError(lookupErr)
+	}
+
+	return statusProto(serverAddr, st), nil
+}
+
+func (s *grpcServer) GetQuery(ctx context.Context, req *rpc.GetQueryRequest) (*rpc.ServerQuery, error) {
+	serverAddr, err := grpcAddress(req.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	query, lookupErr := lookupQuery(ctx, serverAddr, grpcRequester(ctx))
+	if lookupErr != nil {
+		return nil, grpcError(lookupErr)
+	}
+
+	return queryProto(serverAddr, query), nil
+}
+
+func (s *grpcServer) BatchGetStatus(ctx context.Context, req *rpc.BatchGetStatusRequest) (*rpc.BatchGetStatusResponse, error) {
+	serverAddrs, err := parseAddresses(req.Addresses)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	results, lookupErr := rateLimitedBatchStatus(ctx, serverAddrs, grpcRequester(ctx))
+	if lookupErr != nil {
+		return nil, grpcError(lookupErr)
+	}
+
+	resp := &rpc.BatchGetStatusResponse{
+		Servers: map[string]*rpc.ServerStatus{},
+		Errors:  map[string]*rpc.Error{},
+	}
+
+	for serverAddr, st := range results {
+		if st.Error != "" {
+			resp.Errors[serverAddr] = errorProto(probeFailure(st.Error))
+		} else {
+			resp.Servers[serverAddr] = statusProto(serverAddr, st)
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *grpcServer) WatchStatus(req *rpc.WatchStatusRequest, stream rpc.Mcapi_WatchStatusServer) error {
+	ctx := stream.Context()
+
+	serverAddrs, err := parseAddresses(req.Addresses)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// Subscribe before looking up the current status, so that no changes
+	// are missed in between.
+	sub := events.subscribe(grpcWatchBuffer, serverAddrs...)
+	defer sub.close()
+
+	results, lookupErr := rateLimitedBatchStatus(ctx, serverAddrs, grpcRequester(ctx))
+	if lookupErr != nil {
+		return grpcError(lookupErr)
+	}
+
+	for _, serverAddr := range serverAddrs {
+		event := &rpc.StatusEvent{
+			Address: serverAddr,
+		}
+
+		if st := results[serverAddr]; st.Error != "" {
+			event.Error = errorProto(probeFailure(st.Error))
+		} else {
+			event.Status = statusProto(serverAddr, st)
+		}
+
+		if err := stream.Send(event); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-sub.events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "events were not received quickly enough")
+			}
+
+			if event.Kind != eventStatus {
+				continue
+			}
+
+			if err := stream.Send(&rpc.StatusEvent{
+				Address: event.Address,
+				Changes: event.Changes,
+				Status:  statusProto(event.Address, event.Status),
+			}); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/syfaro/mcapi/rpc"
+	"github.com/syfaro/mcapi/types"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCError(t *testing.T) {
+	tests := []struct {
+		err  *lookupError
+		want codes.Code
+	}{
+		{&lookupError{Code: types.ErrorMissingAddress}, codes.InvalidArgument},
+		{&lookupError{Code: types.ErrorInvalidAddress}, codes.InvalidArgument},
+		{&lookupError{Code: types.ErrorUnavailable}, codes.Unavailable},
+		{&lookupError{Code: types.ErrorInvalidKey}, codes.Unauthenticated},
+		{&lookupError{Code: types.ErrorForbidden}, codes.PermissionDenied},
+		{&lookupError{Code: "something_new"}, codes.Unknown},
+	}
+
+	for _, test := range tests {
+		if got := status.Code(grpcError(test.err)); got != test.want {
+			t.Errorf("%s: expected %s, got %s", test.err.Code, test.want, got)
+		}
+	}
+
+	st := status.Convert(grpcError(&lookupError{
+		Status:   http.StatusTooManyRequests,
+		Code:     types.ErrorRateLimited,
+		Message:  "rate limited",
+		TryAfter: 30,
+	}))
+
+	if st.Code() != codes.ResourceExhausted || st.Message() != "rate limited" {
+		t.Errorf("unexpected status %v", st)
+	}
+
+	details := st.Details()
+	if len(details) != 1 {
+		t.Fatalf("expected retry info, got %v", details)
+	}
+
+	if info, ok := details[0].(*errdetails.RetryInfo); !ok || info.RetryDelay.AsDuration() != 30*time.Second {
+		t.Errorf("unexpected retry info %v", details[0])
+	}
+}
+
+func TestGRPCLookups(t *testing.T) {
+	fieldsRouter()
+	pingMap.Set("down.example.com:25565", &types.ServerStatus{
+		Status:      "error",
+		Error:       "connection refused",
+		LastUpdated: "0",
+	})
+
+	server := &grpcServer{}
+	ctx := context.Background()
+
+	for _, address := range []string{"", "example.com:notaport"} {
+		if _, err := server.GetStatus(ctx, &rpc.GetStatusRequest{Address: address}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%q: expected an invalid argument, got %v", address, err)
+		}
+	}
+
+	resp, err := server.GetStatus(ctx, &rpc.GetStatusRequest{Address: "Example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Address != "example.com:25565" || !resp.Online || resp.Players.Now != 3 || resp.LastUpdated == nil {
+		t.Errorf("unexpected status %v", resp)
+	}
+
+	batch, err := server.BatchGetStatus(ctx, &rpc.BatchGetStatusRequest{Addresses: []string{"example.com", "down.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if batch.Servers["example.com:25565"] == nil {
+		t.Error("expected the online server to be included")
+	}
+
+	if e := batch.Errors["down.example.com:25565"]; e == nil || e.Code != string(types.ErrorUnavailable) {
+		t.Errorf("expected the failed server to be unavailable, got %v", e)
+	}
+
+	if _, err := server.BatchGetStatus(ctx, &rpc.BatchGetStatusRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected a missing address list to be rejected, got %v", err)
+	}
+}
+
+func TestGRPCAPIKey(t *testing.T) {
+	store, key, secret := newTestKey(t, &apiKeyRequest{Name: "test", Tier: "unlimited"})
+	_, limited, limitedSecret := newTestKey(t, &apiKeyRequest{Name: "limited", Endpoints: []string{"/mcapi.Mcapi/GetQuery"}})
+	store.add(limited)
+
+	previous := apiKeys
+	apiKeys = store
+	defer func() { apiKeys = previous }()
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/mcapi.Mcapi/GetStatus"}
+
+	call := func(secret string) (string, error) {
+		ctx := context.Background()
+		if secret != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(grpcAPIKeyHeader, secret))
+		}
+
+		var caller string
+		_, err := grpcUnaryAPIKey(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			caller = grpcRequester(ctx)
+			return nil, nil
+		})
+
+		return caller, err
+	}
+
+	if caller, err := call(""); err != nil || caller != "" {
+		t.Errorf("expected calls without a key to be allowed, got %q, %v", caller, err)
+	}
+
+	if caller, err := call(secret); err != nil || caller != apiKeyRequester+key.ID {
+		t.Errorf("expected the key to identify the caller, got %q, %v", caller, err)
+	}
+
+	if _, err := call("mcapi_wrong"); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected an invalid key to be rejected, got %v", err)
+	}
+
+	if _, err := call(limitedSecret); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected a key for other methods to be rejected, got %v", err)
+	}
+}
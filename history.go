@@ -0,0 +1,146 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/syfaro/mcapi/types"
+)
+
+// defaultHistoryRetention is how long status history is kept.
+const defaultHistoryRetention = 24 * time.Hour
+
+// historyPruneInterval is how often old history is removed.
+const historyPruneInterval = 5 * time.Minute
+
+// historyPoint is whether a server was online, and how many players it had,
+// at one refresh.
+type historyPoint struct {
+	Time    time.Time `json:"time"`
+	Online  bool      `json:"online"`
+	Players int       `json:"players"`
+}
+
+// uptime summarizes the history of a server over a period.
+type uptime struct {
+	Hours   int     `json:"hours"`
+	Samples int     `json:"samples"`
+	Online  int     `json:"online"`
+	Ratio   float64 `json:"ratio"`
+}
+
+// storedPoint is a historyPoint packed to take less memory, as a point is
+// kept for every refresh of every server.
+type storedPoint struct {
+	unix    int64
+	players int32
+	online  bool
+}
+
+// statusHistory holds recent status points of every tracked server.
+type statusHistory struct {
+	mu        sync.RWMutex
+	retention time.Duration
+	points    map[string][]storedPoint
+}
+
+var history = &statusHistory{
+	retention: defaultHistoryRetention,
+	points:    map[string][]storedPoint{},
+}
+
+// record adds a point from a successful refresh.
+func (h *statusHistory) record(serverAddr string, status *types.ServerStatus) {
+	if status.Status != "success" {
+		return
+	}
+
+	point := storedPoint{
+		unix:    time.Now().Unix(),
+		players: int32(status.Players.Now),
+		online:  status.Online,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.points[serverAddr] = append(h.points[serverAddr], point)
+}
+
+// since returns the points of a server recorded after a time.
+func (h *statusHistory) since(serverAddr string, t time.Time) []historyPoint {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var points []historyPoint
+
+	for _, point := range h.points[serverAddr] {
+		if point.unix < t.Unix() {
+			continue
+		}
+
+		points = append(points, historyPoint{
+			Time:    time.Unix(point.unix, 0).UTC(),
+			Online:  point.online,
+			Players: int(point.players),
+		})
+	}
+
+	return points
+}
+
+// uptime returns how often a server was online over the last hours.
+func (h *statusHistory) uptime(serverAddr string, hours int) *uptime {
+	result := &uptime{
+		Hours: hours,
+	}
+
+	for _, point := range h.since(serverAddr, time.Now().Add(-time.Duration(hours)*time.Hour)) {
+		result.Samples++
+
+		if point.Online {
+			result.Online++
+		}
+	}
+
+	if result.Samples > 0 {
+		result.Ratio = float64(result.Online) / float64(result.Samples)
+	}
+
+	return result
+}
+
+// prune removes points older than the retention, and servers which are
+// no longer cached.
+func (h *statusHistory) prune() {
+	cutoff := time.Now().Add(-h.retention).Unix()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for serverAddr, points := range h.points {
+		if !pingMap.Has(serverAddr) {
+			delete(h.points, serverAddr)
+			continue
+		}
+
+		i := 0
+		for i < len(points) && points[i].unix < cutoff {
+			i++
+		}
+
+		if i == len(points) {
+			delete(h.points, serverAddr)
+		} else if i > 0 {
+			h.points[serverAddr] = append([]storedPoint(nil), points[i:]...)
+		}
+	}
+}
+
+// expire periodically prunes the history, whether or not servers are being
+// fetched.
+func (h *statusHistory) expire() {
+	for range time.Tick(historyPruneInterval) {
+		h.prune()
+	}
+}
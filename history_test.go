@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/syfaro/mcapi/types"
+)
+
+func TestHistoryUptime(t *testing.T) {
+	h := &statusHistory{
+		retention: time.Hour,
+		points:    map[string][]storedPoint{},
+	}
+
+	h.record("a:25565", &types.ServerStatus{Status: "success", Online: true, Players: types.ServerStatusPlayers{Now: 3}})
+	h.record("a:25565", &types.ServerStatus{Status: "success", Online: false})
+	h.record("a:25565", &types.ServerStatus{Status: "error", Error: "query was cancelled"})
+
+	up := h.uptime("a:25565", 1)
+	if up.Samples != 2 || up.Online != 1 || up.Ratio != 0.5 {
+		t.Errorf("unexpected uptime %+v", up)
+	}
+
+	if points := h.since("a:25565", time.Now().Add(-time.Minute)); len(points) != 2 || points[0].Players != 3 {
+		t.Errorf("unexpected points %+v", points)
+	}
+}
+
+func TestHistoryPrune(t *testing.T) {
+	pingMap = newServerCache(0, 0)
+	pingMap.Set("a:25565", &types.ServerStatus{})
+	pingMap.Set("old:25565", &types.ServerStatus{})
+
+	now := time.Now()
+
+	h := &statusHistory{
+		retention: time.Hour,
+		points: map[string][]storedPoint{
+			"a:25565": {
+				{unix: now.Add(-2 * time.Hour).Unix(), online: true},
+				{unix: now.Add(-time.Minute).Unix(), online: true},
+			},
+			"old:25565":     {{unix: now.Add(-2 * time.Hour).Unix()}},
+			"evicted:25565": {{unix: now.Unix()}},
+		},
+	}
+
+	h.prune()
+
+	if points := h.points["a:25565"]; len(points) != 1 {
+		t.Errorf("expected old points to be removed, got %v", points)
+	}
+
+	if _, ok := h.points["old:25565"]; ok {
+		t.Error("expected servers without recent points to be removed")
+	}
+
+	if _, ok := h.points["evicted:25565"]; ok {
+		t.Error("expected servers which are no longer cached to be removed")
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"strconv"
+
+	"github.com/fogleman/gg"
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+	"golang.org/x/image/draw"
+)
+
+const (
+	iconMinSize = 16
+	iconMaxSize = 256
+
+	// iconMaxAge is how long an icon may be cached. The ETag only depends
+	// on the image, so it can be revalidated cheaply after that.
+	iconMaxAge = 24 * 60 * 60
+	// iconFallbackMaxAge is how long the default icon may be cached. It is
+	// short, as the server may only have failed to respond briefly.
+	iconFallbackMaxAge = 5 * 60
+
+	// iconCacheEntries and iconCacheBytes limit how many encoded icons are
+	// kept, so each size of an icon is only encoded once.
+	iconCacheEntries = 4096
+	iconCacheBytes   = 64 << 20
+)
+
+// defaultIcon is the image used for servers without an icon.
+var defaultIcon = "files/grass_sm.png"
+
+// iconCache holds encoded icons, keyed by ETag.
+var iconCache = newServerCache(iconCacheEntries, iconCacheBytes)
+
+// encodedIcon is an icon encoded as a PNG. fallback is set if it is the
+// default icon because the favicon could not be decoded.
+type encodedIcon struct {
+	data     []byte
+	fallback bool
+}
+
+// iconImage decodes a favicon, or loads the default icon if there is no
+// valid favicon. fallback is set if the default icon was used.
+func iconImage(favicon string, c *gin.Context) (img image.Image, fallback bool, err error) {
+	if favicon != "" {
+		img, err := types.ServerStatus{Favicon: favicon}.Image()
+		if err == nil {
+			return img, false, nil
+		}
+
+		c.Error(err)
+	}
+
+	img, err = gg.LoadPNG(defaultIcon)
+
+	return img, true, err
+}
+
+// encodeIcon creates the PNG for an icon at a size, or its original size
+// if size is zero.
+func encodeIcon(favicon string, size int, c *gin.Context) (*encodedIcon, error) {
+	img, fallback, err := iconImage(favicon, c)
+	if err != nil {
+		return nil, err
+	}
+
+	if size > 0 {
+		img = resizeIcon(img, size)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return &encodedIcon{data: buf.Bytes(), fallback: fallback}, nil
+}
+
+// iconCacheControl allows an icon to be cached for a day, or only briefly
+// if it is the default icon or the server could not be reached.
+func iconCacheControl(c *gin.Context, short bool) {
+	maxAge := iconMaxAge
+	if short {
+		maxAge = iconFallbackMaxAge
+	}
+
+	c.Writer.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d, public, s-maxage=%d", maxAge, maxAge))
+}
+
+// resizeIcon scales an icon to fit within size pixels, keeping its aspect
+// ratio. Nearest neighbour scaling keeps pixel art sharp.
+func resizeIcon(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	width, height := size, size
+
+	if bounds.Dx() > bounds.Dy() {
+		height = size * bounds.Dy() / bounds.Dx()
+	} else if bounds.Dy() > bounds.Dx() {
+		width = size * bounds.Dx() / bounds.Dy()
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.NearestNeighbor.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+	return dst
+}
+
+func respondServerIcon(c *gin.Context) {
+	serverAddr, err := requestAddress(c)
+	if err != nil {
+		render(c, http.StatusBadRequest, &errorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	size := 0
+	if param := c.Request.Form.Get("size"); param != "" {
+		size, err = strconv.Atoi(param)
+		if err != nil || size < iconMinSize || size > iconMaxSize {
+			render(c, http.StatusBadRequest, &errorResponse{
+				Error: fmt.Sprintf("size must be between %d and %d", iconMinSize, iconMaxSize),
+			})
+			return
+		}
+	}
+
+	status := getStatusFromCacheOrUpdate(serverAddr, c, false)
+	if status == nil {
+		return
+	}
+
+	// The ETag only depends on the favicon and size, so it is known
+	// without decoding anything.
+	source := status.Favicon
+	if source == "" {
+		source = defaultIcon
+	}
+
+	etag := contentETag([]byte(source), []byte(strconv.Itoa(size)))
+
+	cached, ok := iconCache.GetOK(etag)
+	fallback := status.Favicon == "" || (ok && cached.(*encodedIcon).fallback)
+
+	c.Writer.Header().Set("ETag", etag)
+	iconCacheControl(c, fallback || status.Error != "")
+
+	if match := c.GetHeader("If-None-Match"); match != "" && etagMatches(match, etag) {
+		c.AbortWithStatus(http.StatusNotModified)
+		return
+	}
+
+	if !ok {
+		icon, err := encodeIcon(status.Favicon, size, c)
+		if err != nil {
+			c.Error(err)
+			noStore(c)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		iconCache.Set(etag, icon)
+		cached = icon
+
+		if icon.fallback {
+			iconCacheControl(c, true)
+		}
+	}
+
+	c.Data(http.StatusOK, "image/png", cached.(*encodedIcon).data)
+}
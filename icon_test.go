@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+)
+
+func iconRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	pingMap = newServerCache(0, 0)
+	pingMap.Set("example.com:25565", &types.ServerStatus{
+		Status:      "success",
+		Online:      true,
+		Favicon:     testFavicon,
+		LastUpdated: now,
+		LastOnline:  now,
+	})
+	pingMap.Set("plain.example.com:25565", &types.ServerStatus{
+		Status:      "success",
+		Online:      true,
+		LastUpdated: now,
+		LastOnline:  now,
+	})
+
+	pingMap.Set("down.example.com:25565", &types.ServerStatus{
+		Status:      "error",
+		Error:       "connection refused",
+		LastUpdated: now,
+	})
+
+	iconCache = newServerCache(iconCacheEntries, iconCacheBytes)
+
+	router := gin.New()
+	router.GET("/server/icon/:address", respondServerIcon)
+
+	return router
+}
+
+func requestIcon(router *gin.Engine, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+	return w
+}
+
+func iconSize(t *testing.T, w *httptest.ResponseRecorder) int {
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	img, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return img.Bounds().Dx()
+}
+
+func TestServerIconResize(t *testing.T) {
+	router := iconRouter()
+
+	if size := iconSize(t, requestIcon(router, "/server/icon/example.com.png")); size != 1 {
+		t.Errorf("expected the original 1 pixel icon, got %d", size)
+	}
+
+	w := requestIcon(router, "/server/icon/example.com.png?size=64")
+	if size := iconSize(t, w); size != 64 {
+		t.Errorf("expected a 64 pixel icon, got %d", size)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/server/icon/example.com.png?size=64", nil)
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for a matching ETag, got %d", w.Code)
+	}
+
+	for _, size := range []string{"8", "512", "big"} {
+		if w := requestIcon(router, "/server/icon/example.com.png?size="+size); w.Code != http.StatusBadRequest {
+			t.Errorf("expected size %s to be rejected, got %d", size, w.Code)
+		}
+	}
+}
+
+func TestServerIconDefault(t *testing.T) {
+	router := iconRouter()
+
+	if size := iconSize(t, requestIcon(router, "/server/icon/plain.example.com.png?size=16")); size != 16 {
+		t.Errorf("expected the default icon scaled to 16 pixels, got %d", size)
+	}
+}
+
+func TestServerIconNotModifiedWithoutEncoding(t *testing.T) {
+	router := iconRouter()
+
+	etag := contentETag([]byte(testFavicon), []byte("32"))
+
+	req := httptest.NewRequest(http.MethodGet, "/server/icon/example.com.png?size=32", nil)
+	req.Header.Set("If-None-Match", etag)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotModified || w.Header().Get("ETag") != etag {
+		t.Errorf("expected 304 for the favicon's ETag, got %d with %s", w.Code, w.Header().Get("ETag"))
+	}
+
+	if iconCache.Len() != 0 {
+		t.Error("expected the icon not to be encoded for a 304")
+	}
+
+	requestIcon(router, "/server/icon/example.com.png?size=32")
+	requestIcon(router, "/server/icon/example.com.png?size=32")
+
+	if iconCache.Len() != 1 {
+		t.Errorf("expected the encoded icon to be cached once, got %d entries", iconCache.Len())
+	}
+}
+
+func TestServerIconFallbackMaxAge(t *testing.T) {
+	router := iconRouter()
+
+	tests := map[string]int{
+		"example.com":       iconMaxAge,
+		"plain.example.com": iconFallbackMaxAge,
+		"down.example.com":  iconFallbackMaxAge,
+	}
+
+	for address, maxAge := range tests {
+		w := requestIcon(router, "/server/icon/"+address+".png")
+
+		want := "max-age=" + strconv.Itoa(maxAge) + ", public, s-maxage=" + strconv.Itoa(maxAge)
+		if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != want {
+			t.Errorf("%s: expected %q, got %d with %q", address, want, w.Code, w.Header().Get("Cache-Control"))
+		}
+	}
+}
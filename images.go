@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"image"
 	_ "image/png"
+	"net"
 	"strconv"
 	"time"
 
@@ -24,22 +26,19 @@ const (
 )
 
 func respondServerImage(c *gin.Context) {
-	c.Request.ParseForm()
+	serverAddr, err := requestAddress(c)
 
-	ip := c.Request.Form.Get("ip")
-	port := c.Request.Form.Get("port")
 	title := c.Request.Form.Get("title")
 	theme := c.Request.Form.Get("theme")
 
-	var serverAddr string
-	var serverDisp string
+	if err != nil {
+		drawMessageImage(c, "Invalid server address.", theme)
+		return
+	}
 
-	if port == "" {
-		serverAddr = ip + ":25565"
-		serverDisp = ip
-	} else {
-		serverAddr = ip + ":" + port
-		serverDisp = serverAddr
+	serverDisp := serverAddr
+	if host, port, err := net.SplitHostPort(serverAddr); err == nil && port == defaultPort {
+		serverDisp = host
 	}
 
 	if title != "" {
@@ -49,18 +48,20 @@ func respondServerImage(c *gin.Context) {
 	status := getStatusFromCacheOrUpdate(serverAddr, c, true)
 
 	if status == nil {
-		dc := gg.NewContext(imageWidth, imageHeight)
+		drawMessageImage(c, "Too many bad requests.", theme)
+		return
+	}
 
-		dc.SetFontFace(inconsolata.Regular8x16)
-		if theme == "dark" {
-			dc.SetRGB(1, 1, 1)
-		} else {
-			dc.SetRGB(0, 0, 0)
-		}
+	last := parseLastUpdated(status.LastUpdated)
+	minutesAgo := int(time.Now().Sub(last).Minutes())
 
-		dc.DrawStringAnchored("Too many bad requests.", imageWidth/2, imageHeight/2, 0.5, 0.5)
+	// The image depends on the status, how it was requested to be drawn and
+	// how long ago it was updated, as that is included in the text.
+	statusData, _ := json.Marshal(status)
+	etag := contentETag(statusData, []byte(serverDisp), []byte(theme), []byte(strconv.Itoa(minutesAgo)))
 
-		dc.EncodePNG(c.Writer)
+	if notModified(c, etag, last) {
+		return
 	}
 
 	var imgToDraw image.Image
@@ -120,10 +121,6 @@ func respondServerImage(c *gin.Context) {
 		dc.DrawString(msg, float64(width+fromImage*2)+tW, lastHeight)
 	}
 
-	i, _ := strconv.ParseInt(status.LastUpdated, 10, 64)
-	last := time.Unix(i, 0)
-	minutesAgo := int(time.Now().Sub(last).Minutes())
-
 	plural := ""
 	if minutesAgo != 1 {
 		plural = "s"
@@ -135,3 +132,19 @@ func respondServerImage(c *gin.Context) {
 
 	dc.EncodePNG(c.Writer)
 }
+
+// drawMessageImage responds with an image containing only a message.
+func drawMessageImage(c *gin.Context, msg, theme string) {
+	dc := gg.NewContext(imageWidth, imageHeight)
+
+	dc.SetFontFace(inconsolata.Regular8x16)
+	if theme == "dark" {
+		dc.SetRGB(1, 1, 1)
+	} else {
+		dc.SetRGB(0, 0, 0)
+	}
+
+	dc.DrawStringAnchored(msg, imageWidth/2, imageHeight/2, 0.5, 0.5)
+
+	dc.EncodePNG(c.Writer)
+}
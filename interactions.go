@@ -0,0 +1,550 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+)
+
+// statusCommand is the name of the slash command, without the slash.
+const statusCommand = "mcstatus"
+
+// Discord interaction and response types.
+const (
+	discordInteractionPing    = 1
+	discordInteractionCommand = 2
+
+	discordResponsePong     = 1
+	discordResponseMessage  = 4
+	discordResponseDeferred = 5
+
+	discordFlagEphemeral = 64
+)
+
+// slackMaxAge is how old a Slack request may be before it is rejected,
+// to prevent requests from being replayed.
+const slackMaxAge = 5 * time.Minute
+
+var (
+	discordPublicKey   ed25519.PublicKey
+	slackSigningSecret []byte
+
+	// publicURL is where this API can be reached, for linking images.
+	// If empty, the host of the request is used.
+	publicURL string
+
+	discordAPI = "https://discord.com/api/v10"
+
+	interactionClient = &http.Client{
+		Timeout: 10 * time.Second,
+	}
+)
+
+type discordInteraction struct {
+	Type          int    `json:"type"`
+	ApplicationID string `json:"application_id"`
+	Token         string `json:"token"`
+	Data          struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Name  string      `json:"name"`
+			Value interface{} `json:"value"`
+		} `json:"options"`
+	} `json:"data"`
+	Member *struct {
+		User discordUser `json:"user"`
+	} `json:"member"`
+	User *discordUser `json:"user"`
+}
+
+type discordUser struct {
+	ID string `json:"id"`
+}
+
+// userID returns who sent an interaction, which may be in a server or a
+// direct message.
+func (i *discordInteraction) userID() string {
+	if i.Member != nil {
+		return i.Member.User.ID
+	}
+
+	if i.User != nil {
+		return i.User.ID
+	}
+
+	return ""
+}
+
+// option returns the value of a string command option.
+func (i *discordInteraction) option(name string) string {
+	for _, option := range i.Data.Options {
+		if option.Name == name {
+			value, _ := option.Value.(string)
+			return value
+		}
+	}
+
+	return ""
+}
+
+// verifyDiscordRequest reads the body of a request, checking that it was
+// signed by Discord.
+func verifyDiscordRequest(c *gin.Context) ([]byte, bool) {
+	if len(discordPublicKey) != ed25519.PublicKeySize {
+		return nil, false
+	}
+
+	signature, err := hex.DecodeString(c.GetHeader("X-Signature-Ed25519"))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return nil, false
+	}
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, false
+	}
+
+	message := append([]byte(c.GetHeader("X-Signature-Timestamp")), body...)
+
+	return body, ed25519.Verify(discordPublicKey, message, signature)
+}
+
+// verifySlackRequest reads the body of a request, checking that it was
+// signed with the Slack signing secret recently.
+func verifySlackRequest(c *gin.Context) ([]byte, bool) {
+	if len(slackSigningSecret) == 0 {
+		return nil, false
+	}
+
+	timestamp := c.GetHeader("X-Slack-Request-Timestamp")
+
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	if age := time.Since(time.Unix(sent, 0)); age > slackMaxAge || age < -slackMaxAge {
+		return nil, false
+	}
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, false
+	}
+
+	mac := hmac.New(sha256.New, slackSigningSecret)
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	return body, hmac.Equal([]byte(expected), []byte(c.GetHeader("X-Slack-Signature")))
+}
+
+// stripFormatting removes Minecraft formatting codes from text.
+func stripFormatting(text string) string {
+	var b strings.Builder
+
+	skip := false
+	for _, r := range text {
+		if skip {
+			skip = false
+			continue
+		}
+
+		if r == '§' {
+			skip = true
+			continue
+		}
+
+		b.WriteRune(r)
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// displayAddress removes the default port from an address.
+func displayAddress(serverAddr string) string {
+	if host, port, err := net.SplitHostPort(serverAddr); err == nil && port == defaultPort {
+		return host
+	}
+
+	return serverAddr
+}
+
+func baseURL(c *gin.Context) string {
+	if publicURL != "" {
+		return strings.TrimSuffix(publicURL, "/")
+	}
+
+	return "https://" + c.Request.Host
+}
+
+// cachedStatus returns the status of a server without pinging it.
+func cachedStatus(serverAddr string) (*types.ServerStatus, bool) {
+	status, ok := pingMap.GetOK(strings.ToLower(serverAddr))
+	if !ok {
+		return nil, false
+	}
+
+	return status.(*types.ServerStatus), true
+}
+
+// commandStatus looks up the status of a server for a slash command,
+// returning a message to show instead if it could not be found.
+func commandStatus(ctx context.Context, serverAddr, caller string) (*types.ServerStatus, string) {
+	status, err := lookupStatus(ctx, serverAddr, caller)
+
+	if err != nil && status == nil {
+		return nil, fmt.Sprintf("Unable to check %s: %s.", displayAddress(serverAddr), err.Message)
+	}
+
+	if err != nil && err.Code == types.ErrorInvalidAddress {
+		return nil, fmt.Sprintf("%s is not a valid server address.", displayAddress(serverAddr))
+	}
+
+	return status, ""
+}
+
+// discordEmbed creates a Discord embed describing a server. If the server
+// has a favicon, the embed expects it to be attached as favicon.png.
+func discordEmbed(serverAddr string, status *types.ServerStatus) gin.H {
+	online := "Offline"
+	color := 0xE74C3C
+	if status.Online {
+		online = "Online"
+		color = 0x6AFF42
+	}
+
+	fields := []gin.H{
+		{"name": "Status", "value": online, "inline": true},
+	}
+
+	if status.Online {
+		fields = append(fields,
+			gin.H{"name": "Players", "value": fmt.Sprintf("%d/%d", status.Players.Now, status.Players.Max), "inline": true},
+			gin.H{"name": "Version", "value": orDash(status.Server.Name), "inline": true},
+		)
+	}
+
+	embed := gin.H{
+		"title":  displayAddress(serverAddr),
+		"color":  color,
+		"fields": fields,
+		"footer": gin.H{"text": "mcapi.us"},
+	}
+
+	if motd := stripFormatting(status.Motd); motd != "" {
+		embed["description"] = motd
+	}
+
+	if updated := parseLastUpdated(status.LastUpdated); !updated.IsZero() {
+		embed["timestamp"] = updated.UTC().Format(time.RFC3339)
+	}
+
+	if status.Favicon != "" {
+		embed["thumbnail"] = gin.H{"url": "attachment://favicon.png"}
+	}
+
+	return embed
+}
+
+// discordStatusMessage creates the message replying to a command, along
+// with the favicon to attach to it if there is one.
+func discordStatusMessage(serverAddr string, status *types.ServerStatus, errMessage string) (gin.H, []byte) {
+	if status == nil {
+		return gin.H{
+			"content": errMessage,
+			"flags":   discordFlagEphemeral,
+		}, nil
+	}
+
+	embed := discordEmbed(serverAddr, status)
+	message := gin.H{
+		"embeds": []gin.H{embed},
+	}
+
+	if status.Favicon == "" {
+		return message, nil
+	}
+
+	favicon, err := status.FaviconPNG()
+	if err != nil {
+		delete(embed, "thumbnail")
+		return message, nil
+	}
+
+	message["attachments"] = []gin.H{{"id": 0, "filename": "favicon.png"}}
+
+	return message, favicon
+}
+
+// discordMultipart encodes a payload as multipart form data so a favicon
+// can be attached to it.
+func discordMultipart(payload gin.H, favicon []byte) (string, []byte, error) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	if err := w.WriteField("payload_json", string(payloadJSON)); err != nil {
+		return "", nil, err
+	}
+
+	if favicon != nil {
+		part, err := w.CreateFormFile("files[0]", "favicon.png")
+		if err != nil {
+			return "", nil, err
+		}
+
+		if _, err := part.Write(favicon); err != nil {
+			return "", nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return "", nil, err
+	}
+
+	return w.FormDataContentType(), body.Bytes(), nil
+}
+
+func respondDiscordInteraction(c *gin.Context) {
+	body, ok := verifyDiscordRequest(c)
+	if !ok {
+		c.String(http.StatusUnauthorized, "invalid request signature")
+		return
+	}
+
+	var interaction discordInteraction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		c.String(http.StatusBadRequest, "invalid interaction")
+		return
+	}
+
+	if interaction.Type == discordInteractionPing {
+		c.JSON(http.StatusOK, gin.H{"type": discordResponsePong})
+		return
+	}
+
+	if interaction.Type != discordInteractionCommand || interaction.Data.Name != statusCommand {
+		c.String(http.StatusBadRequest, "unknown interaction")
+		return
+	}
+
+	serverAddr, err := parseAddress(interaction.option("address"))
+	if err != nil {
+		message, _ := discordStatusMessage("", nil, "Please give a valid server address.")
+		c.JSON(http.StatusOK, gin.H{
+			"type": discordResponseMessage,
+			"data": message,
+		})
+		return
+	}
+
+	// Discord only waits three seconds for a reply, so servers which are
+	// not cached are pinged after deferring it.
+	if status, ok := cachedStatus(serverAddr); ok {
+		message, favicon := discordStatusMessage(serverAddr, status, "")
+
+		contentType, data, err := discordMultipart(gin.H{
+			"type": discordResponseMessage,
+			"data": message,
+		}, favicon)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.Data(http.StatusOK, contentType, data)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"type": discordResponseDeferred})
+
+	go func() {
+		status, errMessage := commandStatus(context.Background(), serverAddr, "discord:"+interaction.userID())
+		message, favicon := discordStatusMessage(serverAddr, status, errMessage)
+
+		if err := editDiscordReply(&interaction, message, favicon); err != nil {
+			raven.CaptureError(err, nil)
+			slog.Error("unable to reply to Discord interaction", "err", err)
+		}
+	}()
+}
+
+// editDiscordReply replaces a deferred reply with a message.
+func editDiscordReply(interaction *discordInteraction, message gin.H, favicon []byte) error {
+	contentType, body, err := discordMultipart(message, favicon)
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("%s/webhooks/%s/%s/messages/@original",
+		discordAPI, url.PathEscape(interaction.ApplicationID), url.PathEscape(interaction.Token))
+
+	req, err := http.NewRequest(http.MethodPatch, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	return sendInteractionReply(req)
+}
+
+func sendInteractionReply(req *http.Request) error {
+	resp, err := interactionClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// slackStatusMessage creates the message replying to a command. Slack can
+// only show images from a URL, so the favicon is linked from the icon
+// endpoint.
+func slackStatusMessage(base, serverAddr string, status *types.ServerStatus, errMessage string) gin.H {
+	if status == nil {
+		return gin.H{
+			"response_type": "ephemeral",
+			"text":          errMessage,
+		}
+	}
+
+	online := "offline"
+	if status.Online {
+		online = "online"
+	}
+
+	summary := fmt.Sprintf("*%s* is %s", displayAddress(serverAddr), online)
+
+	section := gin.H{
+		"type": "section",
+		"text": gin.H{"type": "mrkdwn", "text": summary},
+	}
+
+	if status.Online {
+		section["fields"] = []gin.H{
+			{"type": "mrkdwn", "text": fmt.Sprintf("*Players*\n%d/%d", status.Players.Now, status.Players.Max)},
+			{"type": "mrkdwn", "text": "*Version*\n" + orDash(status.Server.Name)},
+		}
+	}
+
+	blocks := []gin.H{section}
+
+	if motd := stripFormatting(status.Motd); motd != "" {
+		blocks = append(blocks, gin.H{
+			"type":     "context",
+			"elements": []gin.H{{"type": "plain_text", "text": motd}},
+		})
+	}
+
+	if status.Favicon != "" {
+		blocks = append(blocks, gin.H{
+			"type":      "image",
+			"image_url": base + "/server/icon/" + url.PathEscape(serverAddr) + ".png",
+			"alt_text":  displayAddress(serverAddr),
+		})
+	}
+
+	return gin.H{
+		"response_type": "in_channel",
+		"text":          strings.Replace(summary, "*", "", -1),
+		"blocks":        blocks,
+	}
+}
+
+func respondSlackCommand(c *gin.Context) {
+	body, ok := verifySlackRequest(c)
+	if !ok {
+		c.String(http.StatusUnauthorized, "invalid request signature")
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil || form.Get("command") != "/"+statusCommand {
+		c.String(http.StatusBadRequest, "unknown command")
+		return
+	}
+
+	serverAddr, err := parseAddress(strings.TrimSpace(form.Get("text")))
+	if err != nil {
+		c.JSON(http.StatusOK, slackStatusMessage("", "", nil, "Usage: /"+statusCommand+" <address>"))
+		return
+	}
+
+	// Slack only waits three seconds for a reply, so servers which are not
+	// cached are pinged before posting the result to the response URL. An
+	// ephemeral reply can't be made public, so the result is a new message.
+	if status, ok := cachedStatus(serverAddr); ok {
+		c.JSON(http.StatusOK, slackStatusMessage(baseURL(c), serverAddr, status, ""))
+		return
+	}
+
+	responseURL := form.Get("response_url")
+	if !strings.HasPrefix(responseURL, "https://") {
+		c.String(http.StatusBadRequest, "missing response_url")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"response_type": "ephemeral",
+		"text":          "Checking " + displayAddress(serverAddr) + "...",
+	})
+
+	caller := "slack:" + form.Get("team_id") + ":" + form.Get("user_id")
+	base := baseURL(c)
+
+	go func() {
+		status, errMessage := commandStatus(context.Background(), serverAddr, caller)
+
+		message := slackStatusMessage(base, serverAddr, status, errMessage)
+		if err := sendSlackReply(responseURL, message); err != nil {
+			raven.CaptureError(err, nil)
+			slog.Error("unable to reply to Slack command", "err", err)
+		}
+	}()
+}
+
+func sendSlackReply(responseURL string, message gin.H) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, responseURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	return sendInteractionReply(req)
+}
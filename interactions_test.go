@@ -0,0 +1,314 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+)
+
+// A 1x1 PNG image.
+const testFavicon = "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg=="
+
+func interactionRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	pingMap = newServerCache(0, 0)
+	pingMap.Set("example.com:25565", &types.ServerStatus{
+		Status:      "success",
+		Online:      true,
+		Motd:        "§aA §lMinecraft§r Server",
+		Favicon:     testFavicon,
+		Players:     types.ServerStatusPlayers{Max: 20, Now: 3},
+		Server:      types.ServerStatusServer{Name: "Paper 1.20.4", Protocol: 765},
+		LastUpdated: strconv.FormatInt(time.Now().Unix(), 10),
+		LastOnline:  strconv.FormatInt(time.Now().Unix(), 10),
+	})
+
+	router := gin.New()
+	router.POST("/interactions/discord", respondDiscordInteraction)
+	router.POST("/interactions/slack", respondSlackCommand)
+
+	return router
+}
+
+func discordRequest(key ed25519.PrivateKey, body string) *http.Request {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := ed25519.Sign(key, []byte(timestamp+body))
+
+	req := httptest.NewRequest(http.MethodPost, "/interactions/discord", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Signature-Ed25519", hex.EncodeToString(signature))
+	req.Header.Set("X-Signature-Timestamp", timestamp)
+
+	return req
+}
+
+func slackRequest(secret string, sent time.Time, form url.Values) *http.Request {
+	body := form.Encode()
+	timestamp := strconv.FormatInt(sent.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+
+	req := httptest.NewRequest(http.MethodPost, "/interactions/slack", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+
+	return req
+}
+
+func newDiscordKey(t *testing.T) ed25519.PrivateKey {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	discordPublicKey = public
+
+	return private
+}
+
+func TestDiscordPing(t *testing.T) {
+	router := interactionRouter()
+	key := newDiscordKey(t)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, discordRequest(key, `{"type":1}`))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if strings.TrimSpace(w.Body.String()) != `{"type":1}` {
+		t.Errorf("unexpected pong %s", w.Body.String())
+	}
+}
+
+func TestDiscordInvalidSignature(t *testing.T) {
+	router := interactionRouter()
+	newDiscordKey(t)
+
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, discordRequest(otherKey, `{"type":1}`))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+
+	// A signature for a different body must also be rejected.
+	key := newDiscordKey(t)
+	req := discordRequest(key, `{"type":1}`)
+	req.Body = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"type":2}`)).Body
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for modified body, got %d", w.Code)
+	}
+}
+
+func TestDiscordStatusCommand(t *testing.T) {
+	router := interactionRouter()
+	key := newDiscordKey(t)
+
+	body := `{"type":2,"application_id":"1","token":"t","data":{"name":"mcstatus","options":[{"name":"address","type":3,"value":"Example.com"}]},"member":{"user":{"id":"2"}}}`
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, discordRequest(key, body))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		t.Fatalf("expected multipart response, got %q", w.Header().Get("Content-Type"))
+	}
+
+	form, err := multipart.NewReader(w.Body, params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var response struct {
+		Type int `json:"type"`
+		Data struct {
+			Embeds []struct {
+				Title       string `json:"title"`
+				Description string `json:"description"`
+				Fields      []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"fields"`
+				Thumbnail struct {
+					URL string `json:"url"`
+				} `json:"thumbnail"`
+			} `json:"embeds"`
+		} `json:"data"`
+	}
+
+	if err := json.Unmarshal([]byte(form.Value["payload_json"][0]), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Type != discordResponseMessage || len(response.Data.Embeds) != 1 {
+		t.Fatalf("unexpected response %s", form.Value["payload_json"][0])
+	}
+
+	embed := response.Data.Embeds[0]
+
+	if embed.Title != "example.com" {
+		t.Errorf("unexpected title %q", embed.Title)
+	}
+
+	if embed.Description != "A Minecraft Server" {
+		t.Errorf("unexpected description %q", embed.Description)
+	}
+
+	fields := map[string]string{}
+	for _, field := range embed.Fields {
+		fields[field.Name] = field.Value
+	}
+
+	if fields["Players"] != "3/20" || fields["Version"] != "Paper 1.20.4" || fields["Status"] != "Online" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+
+	if embed.Thumbnail.URL != "attachment://favicon.png" {
+		t.Errorf("unexpected thumbnail %q", embed.Thumbnail.URL)
+	}
+
+	if len(form.File["files[0]"]) != 1 || form.File["files[0]"][0].Filename != "favicon.png" {
+		t.Errorf("favicon was not attached")
+	}
+}
+
+func TestSlackStatusCommand(t *testing.T) {
+	router := interactionRouter()
+	slackSigningSecret = []byte("secret")
+	publicURL = "https://mcapi.example"
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, slackRequest("secret", time.Now(), url.Values{
+		"command": {"/mcstatus"},
+		"text":    {"example.com"},
+	}))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		ResponseType string `json:"response_type"`
+		Blocks       []struct {
+			Type     string `json:"type"`
+			ImageURL string `json:"image_url"`
+			Text     struct {
+				Text string `json:"text"`
+			} `json:"text"`
+			Fields []struct {
+				Text string `json:"text"`
+			} `json:"fields"`
+		} `json:"blocks"`
+	}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.ResponseType != "in_channel" || len(response.Blocks) != 3 {
+		t.Fatalf("unexpected response %s", w.Body.String())
+	}
+
+	if response.Blocks[0].Text.Text != "*example.com* is online" {
+		t.Errorf("unexpected summary %q", response.Blocks[0].Text.Text)
+	}
+
+	if len(response.Blocks[0].Fields) != 2 || response.Blocks[0].Fields[0].Text != "*Players*\n3/20" {
+		t.Errorf("unexpected fields %v", response.Blocks[0].Fields)
+	}
+
+	if response.Blocks[2].ImageURL != "https://mcapi.example/server/icon/example.com:25565.png" {
+		t.Errorf("unexpected image %q", response.Blocks[2].ImageURL)
+	}
+}
+
+func TestSlackStatusFollowUp(t *testing.T) {
+	router := interactionRouter()
+	slackSigningSecret = []byte("secret")
+	serverAddr := fakeStatusServer(t, statusPacket(capturedStatus))
+
+	replies := make(chan map[string]interface{}, 1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&message)
+		replies <- message
+	}))
+	defer server.Close()
+
+	previous := interactionClient
+	interactionClient = server.Client()
+	defer func() { interactionClient = previous }()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, slackRequest("secret", time.Now(), url.Values{
+		"command":      {"/mcstatus"},
+		"text":         {serverAddr},
+		"response_url": {server.URL},
+	}))
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Checking") {
+		t.Fatalf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+
+	select {
+	case message := <-replies:
+		if message["response_type"] != "in_channel" || message["replace_original"] != nil {
+			t.Errorf("expected the result to be a new public message, got %v", message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no follow-up was sent")
+	}
+}
+
+func TestSlackInvalidSignature(t *testing.T) {
+	router := interactionRouter()
+	slackSigningSecret = []byte("secret")
+
+	form := url.Values{
+		"command": {"/mcstatus"},
+		"text":    {"example.com"},
+	}
+
+	tests := map[string]*http.Request{
+		"wrong secret": slackRequest("other", time.Now(), form),
+		"old request":  slackRequest("secret", time.Now().Add(-10*time.Minute), form),
+	}
+
+	for name, req := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, w.Code)
+		}
+	}
+}
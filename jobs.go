@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"github.com/gin-gonic/gin"
+	"github.com/gocraft/work"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// updateInterval is how often every tracked server is refreshed.
+// Jobs which have waited in the queue for longer than this are dropped,
+// as the next scheduled run will already have enqueued a fresh one.
+const updateInterval = 5 * time.Minute
+
+// queueMonitorInterval is how often queue depth and lag are checked.
+const queueMonitorInterval = time.Minute
+
+func updateServers() {
+	pingMap.ForEachLocked(func(key string, _ interface{}) bool {
+		enqueueUpdate("status", key)
+
+		return true
+	})
+
+	queryMap.ForEachLocked(func(key string, _ interface{}) bool {
+		enqueueUpdate("query", key)
+
+		return true
+	})
+
+	// Servers with webhooks are refreshed even if they were evicted, unless
+	// they have been unreachable for too long.
+	webhooks.prune(time.Now())
+
+	for _, serverAddr := range webhooks.addresses() {
+		enqueueUpdate("status", serverAddr)
+	}
+}
+
+// enqueueUpdate adds a scheduled refresh job for a server to the bulk lane.
+func enqueueUpdate(kind, serverAddr string) {
+	enqueueLaneUpdate(context.Background(), kind, serverAddr, laneBulk)
+}
+
+// enqueueLaneUpdate adds a refresh job for a server to a lane. Jobs are
+// unique per kind and address, so if one is already pending it is reused
+// rather than adding another to the queue.
+func enqueueLaneUpdate(ctx context.Context, kind, serverAddr, laneName string) {
+	ctx, span := tracer.Start(ctx, "enqueue "+laneJobName(kind, laneName), trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("mcapi.server", serverAddr)))
+
+	added, err := jobs.enqueueUnique(ctx, laneJobName(kind, laneName), serverAddr)
+	endSpan(span, err)
+
+	if err != nil {
+		raven.CaptureError(err, nil)
+		slog.Error("unable to enqueue job", "kind", kind, "server", serverAddr, "err", err)
+		return
+	}
+
+	if !added {
+		slog.Debug("coalesced job with pending job", "kind", kind, "server", serverAddr)
+	}
+}
+
+type JobCtx struct{}
+
+func jobMiddleware(job *work.Job, next work.NextMiddlewareFunc) error {
+	waited := time.Since(time.Unix(job.EnqueuedAt, 0))
+	if waited > updateInterval && !strings.HasSuffix(job.Name, "_"+laneInteractive) {
+		slog.Warn("dropping overdue job", "job", job.Name, "job_id", job.ID, "args", job.Args, "waited", waited)
+		return nil
+	}
+
+	slog.Debug("running job", "job", job.Name, "job_id", job.ID, "args", job.Args)
+	return next()
+}
+
+func jobUpdate(job *work.Job) error {
+	if _, ok := job.Args["serverAddr"]; !ok {
+		return errors.New("missing server address")
+	}
+
+	serverAddr := job.ArgString("serverAddr")
+
+	ctx, span := startJobSpan(job)
+	ctx = withLogger(ctx, slog.Default().With("job", job.Name, "job_id", job.ID))
+
+	var errString string
+
+	defer func() {
+		if errString != "" {
+			span.SetStatus(codes.Error, errString)
+		}
+
+		span.End()
+	}()
+
+	switch strings.TrimSuffix(job.Name, "_"+laneInteractive) {
+	case "query":
+		ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+		defer cancel()
+
+		errString = updateQuery(ctx, serverAddr).Error
+	case "status":
+		ctx, cancel := context.WithTimeout(ctx, statusTimeout)
+		defer cancel()
+
+		errString = updatePing(ctx, serverAddr).Error
+	}
+
+	if errString != "" {
+		return errors.New(errString)
+	}
+
+	return nil
+}
+
+// monitorQueues periodically logs the depth and lag of each job queue at
+// debug level, warning when jobs are waiting longer than a full update
+// interval.
+func monitorQueues() {
+	for range time.Tick(queueMonitorInterval) {
+		queues, err := jobs.queues()
+		if err != nil {
+			raven.CaptureError(err, nil)
+			slog.Error("unable to load job queues", "err", err)
+			continue
+		}
+
+		for _, queue := range queues {
+			lag := time.Duration(queue.Latency) * time.Second
+
+			if lag > updateInterval {
+				slog.Warn("queue is behind", "queue", queue.JobName, "jobs", queue.Count, "lag", lag)
+			} else {
+				slog.Debug("queue", "queue", queue.JobName, "jobs", queue.Count, "lag", lag)
+			}
+		}
+	}
+}
+
+func respondJobQueues(c *gin.Context) {
+	if jobs == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "fetching is not enabled",
+		})
+		return
+	}
+
+	queues, err := jobs.queues()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"queues": queues,
+	})
+}
+
+// respondAdminRefresh queues an immediate refresh of a server in the
+// interactive lane, ahead of any scheduled refreshes.
+func respondAdminRefresh(c *gin.Context) {
+	serverAddr, err := requestAddress(c)
+	if err == errMissingAddress {
+		c.String(http.StatusBadRequest, "Missing data.")
+		return
+	} else if err != nil {
+		c.String(http.StatusBadRequest, "Invalid server address.")
+		return
+	}
+
+	if jobs == nil {
+		c.String(http.StatusServiceUnavailable, "Fetching is not enabled.")
+		return
+	}
+
+	enqueueLaneUpdate(c.Request.Context(), "status", serverAddr, laneInteractive)
+	enqueueLaneUpdate(c.Request.Context(), "query", serverAddr, laneInteractive)
+
+	c.String(http.StatusOK, "Queued refresh.")
+}
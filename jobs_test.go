@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocraft/work"
+	"github.com/syfaro/mcapi/types"
+)
+
+func TestUpdateServersCoalesces(t *testing.T) {
+	previous := jobs
+	defer func() { jobs = previous }()
+
+	queue := newMemoryJobQueue()
+	jobs = queue
+
+	pingMap = newServerCache(0, 0)
+	pingMap.Set("a:25565", &types.ServerStatus{})
+	pingMap.Set("b:25565", &types.ServerStatus{})
+
+	queryMap = newServerCache(0, 0)
+	queryMap.Set("a:25565", &types.ServerQuery{})
+
+	updateServers()
+	updateServers()
+
+	counts := map[string]int{}
+	for _, job := range queue.snapshot() {
+		counts[job.Name+" "+job.ArgString("serverAddr")]++
+	}
+
+	want := map[string]int{"status a:25565": 1, "status b:25565": 1, "query a:25565": 1}
+	if len(counts) != len(want) {
+		t.Fatalf("expected %v, got %v", want, counts)
+	}
+
+	for key, count := range want {
+		if counts[key] != count {
+			t.Errorf("expected %d %s jobs, got %d", count, key, counts[key])
+		}
+	}
+}
+
+func TestJobMiddlewareDropsOverdue(t *testing.T) {
+	overdue := time.Now().Add(-2 * updateInterval).Unix()
+
+	tests := []struct {
+		name string
+		job  *work.Job
+		run  bool
+	}{
+		{"current", &work.Job{Name: "status", EnqueuedAt: time.Now().Unix()}, true},
+		{"overdue", &work.Job{Name: "status", EnqueuedAt: overdue}, false},
+		{"overdue interactive", &work.Job{Name: laneJobName("status", laneInteractive), EnqueuedAt: overdue}, true},
+	}
+
+	for _, test := range tests {
+		ran := false
+
+		jobMiddleware(test.job, func() error {
+			ran = true
+			return nil
+		})
+
+		if ran != test.run {
+			t.Errorf("%s: expected run to be %v", test.name, test.run)
+		}
+	}
+}
+
+func TestAdminRefreshAddress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	previous := jobs
+	defer func() { jobs = previous }()
+
+	queue := newMemoryJobQueue()
+	jobs = queue
+
+	router := gin.New()
+	router.POST("/refresh", respondAdminRefresh)
+
+	for _, path := range []string{"/refresh?ip=Example.com:25566&port=25566", "/refresh?ip=other.example.com"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: unexpected status %d", path, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/refresh?ip=example.com&port=0", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected an invalid port to be rejected, got %d", w.Code)
+	}
+
+	servers := map[string]bool{}
+	for _, job := range queue.snapshot() {
+		servers[job.ArgString("serverAddr")] = true
+	}
+
+	if len(servers) != 2 || !servers["example.com:25566"] || !servers["other.example.com:25565"] {
+		t.Errorf("unexpected servers refreshed %v", servers)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocraft/work"
+)
+
+const (
+	laneInteractive = "interactive"
+	laneBulk        = "bulk"
+)
+
+const (
+	defaultInteractiveWorkers = 10
+	defaultBulkWorkers        = 50
+)
+
+// interactiveLane runs probes a user is waiting on, such as cache misses
+// and explicit refreshes. bulkLane runs the scheduled sweeps of every
+// tracked server. Each has its own workers, so a large backlog of routine
+// refreshes never delays interactive ones.
+var interactiveLane = newLane(laneInteractive, defaultInteractiveWorkers)
+var bulkLane = newLane(laneBulk, defaultBulkWorkers)
+
+// lane limits how many probes may run at once and keeps track of how long
+// they waited and how long they took.
+type lane struct {
+	name  string
+	slots chan struct{}
+
+	active    int64
+	completed int64
+	waitNanos int64
+	runNanos  int64
+}
+
+// laneStats is a snapshot of a lane's counters.
+type laneStats struct {
+	Name          string  `json:"name"`
+	Capacity      int     `json:"capacity"`
+	Active        int64   `json:"active"`
+	Completed     int64   `json:"completed"`
+	AverageWaitMs float64 `json:"average_wait_ms"`
+	AverageRunMs  float64 `json:"average_run_ms"`
+}
+
+func newLane(name string, capacity int) *lane {
+	return &lane{
+		name:  name,
+		slots: make(chan struct{}, capacity),
+	}
+}
+
+func (l *lane) capacity() int {
+	return cap(l.slots)
+}
+
+// run waits for a free slot and then calls fn. queuedAt is when the work
+// was first requested, so time spent in the job queue counts as waiting.
+// If ctx ends before a slot is free, fn is not called.
+func (l *lane) run(ctx context.Context, queuedAt time.Time, fn func()) error {
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	started := time.Now()
+	atomic.AddInt64(&l.waitNanos, int64(started.Sub(queuedAt)))
+	atomic.AddInt64(&l.active, 1)
+
+	defer func() {
+		atomic.AddInt64(&l.runNanos, int64(time.Since(started)))
+		atomic.AddInt64(&l.active, -1)
+		atomic.AddInt64(&l.completed, 1)
+
+		<-l.slots
+	}()
+
+	fn()
+
+	return nil
+}
+
+func (l *lane) stats() laneStats {
+	stats := laneStats{
+		Name:      l.name,
+		Capacity:  l.capacity(),
+		Active:    atomic.LoadInt64(&l.active),
+		Completed: atomic.LoadInt64(&l.completed),
+	}
+
+	if stats.Completed > 0 {
+		completed := float64(stats.Completed)
+
+		stats.AverageWaitMs = float64(atomic.LoadInt64(&l.waitNanos)) / completed / float64(time.Millisecond)
+		stats.AverageRunMs = float64(atomic.LoadInt64(&l.runNanos)) / completed / float64(time.Millisecond)
+	}
+
+	return stats
+}
+
+// laneJobName is the name of the job queue for a kind of update in a lane.
+// Bulk jobs keep their original names so already queued jobs still run.
+func laneJobName(kind, laneName string) string {
+	if laneName == laneBulk {
+		return kind
+	}
+
+	return kind + "_" + laneName
+}
+
+// laneJob wraps a job handler so it runs in a lane.
+func laneJob(l *lane, fn func(*work.Job) error) func(*work.Job) error {
+	return func(job *work.Job) error {
+		var err error
+
+		l.run(context.Background(), time.Unix(job.EnqueuedAt, 0), func() {
+			err = fn(job)
+		})
+
+		return err
+	}
+}
+
+func respondLanes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"lanes": []laneStats{
+			interactiveLane.stats(),
+			bulkLane.stats(),
+		},
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gocraft/work"
+)
+
+func TestLaneCapacity(t *testing.T) {
+	l := newLane("test", 1)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	go l.run(context.Background(), time.Now(), func() {
+		close(started)
+		<-release
+	})
+
+	<-started
+
+	if stats := l.stats(); stats.Active != 1 || stats.Capacity != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	ran := false
+	if err := l.run(ctx, time.Now(), func() { ran = true }); err != context.DeadlineExceeded || ran {
+		t.Errorf("expected a full lane to give up when the context ends, got %v", err)
+	}
+
+	close(release)
+
+	if err := l.run(context.Background(), time.Now(), func() { ran = true }); err != nil || !ran {
+		t.Errorf("expected the lane to run once a slot is free, got %v", err)
+	}
+
+	if stats := l.stats(); stats.Active != 0 || stats.Completed != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestLanesIndependent(t *testing.T) {
+	bulk := newLane(laneBulk, 1)
+	interactive := newLane(laneInteractive, 1)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	started := make(chan struct{})
+	go bulk.run(context.Background(), time.Now(), func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := interactive.run(ctx, time.Now(), func() {}); err != nil {
+		t.Errorf("expected a busy bulk lane not to delay interactive work, got %v", err)
+	}
+}
+
+func TestLaneJobNames(t *testing.T) {
+	if name := laneJobName("status", laneBulk); name != "status" {
+		t.Errorf("expected bulk jobs to keep their names, got %s", name)
+	}
+
+	if name := laneJobName("query", laneInteractive); name != "query_interactive" {
+		t.Errorf("unexpected interactive job name %s", name)
+	}
+
+	l := newLane("test", 1)
+	job := &work.Job{EnqueuedAt: time.Now().Add(-time.Second).Unix()}
+
+	laneJob(l, func(*work.Job) error { return nil })(job)
+
+	if stats := l.stats(); stats.AverageWaitMs < 500 {
+		t.Errorf("expected time in the queue to count as waiting, got %+v", stats)
+	}
+}
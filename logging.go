@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	logFormatJSON = "json"
+	logFormatText = "text"
+
+	// requestIDHeader is where a request ID is read from, if the client or a
+	// proxy in front of the API set one, and where it is returned.
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLength is the longest request ID accepted from a client.
+	maxRequestIDLength = 64
+)
+
+// newLogHandler creates a handler writing logfmt style text, or JSON if
+// format is json.
+func newLogHandler(w io.Writer, format string, level slog.Leveler) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level}
+
+	if format == logFormatJSON {
+		return slog.NewJSONHandler(w, opts)
+	}
+
+	return slog.NewTextHandler(w, opts)
+}
+
+// setupLogging sends every log line, including those from the log package,
+// to stdout and, if LogFile is set, to a file which is rotated as it grows.
+func setupLogging(cfg *Config) error {
+	var level slog.Level
+	if cfg.LogLevel != "" {
+		if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+			return err
+		}
+	}
+
+	var w io.Writer = os.Stdout
+
+	if cfg.LogFile != "" {
+		w = io.MultiWriter(os.Stdout, &lumberjack.Logger{
+			Filename:   cfg.LogFile,
+			MaxSize:    cfg.LogMaxSizeMB,
+			MaxBackups: cfg.LogMaxBackups,
+			MaxAge:     cfg.LogMaxAgeDays,
+			Compress:   true,
+		})
+	}
+
+	slog.SetDefault(slog.New(newLogHandler(w, cfg.LogFormat, level)))
+
+	return nil
+}
+
+type loggerKey struct{}
+
+// withLogger attaches a logger to a context, so everything done for one
+// request or job is logged with the same attributes.
+func withLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// logger returns the logger attached to a context, or the default logger.
+func logger(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+
+	return slog.Default()
+}
+
+// validRequestID reports whether a request ID from a client is safe to log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	return strings.IndexFunc(id, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+	}) == -1
+}
+
+// logRequests gives each request an ID, attaches a logger with it to the
+// request's context and logs the request once it has been handled.
+func logRequests(c *gin.Context) {
+	started := time.Now()
+
+	id := c.GetHeader(requestIDHeader)
+	if !validRequestID(id) {
+		id = randomHex(8)
+	}
+
+	c.Header(requestIDHeader, id)
+
+	l := slog.Default().With("request_id", id)
+	if span := trace.SpanContextFromContext(c.Request.Context()); span.IsValid() {
+		l = l.With("trace_id", span.TraceID().String())
+	}
+
+	c.Request = c.Request.WithContext(withLogger(c.Request.Context(), l))
+
+	c.Next()
+
+	l.Info("request",
+		"method", c.Request.Method,
+		"path", c.Request.URL.Path,
+		"route", c.FullPath(),
+		"status", c.Writer.Status(),
+		"bytes", c.Writer.Size(),
+		"duration_ms", float64(time.Since(started))/float64(time.Millisecond),
+		"requester", requester(c),
+	)
+}
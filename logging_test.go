@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLogRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var buf bytes.Buffer
+
+	previous := slog.Default()
+	slog.SetDefault(slog.New(newLogHandler(&buf, logFormatJSON, slog.LevelInfo)))
+	defer slog.SetDefault(previous)
+
+	router := gin.New()
+	router.Use(logRequests)
+	router.GET("/server/status/:address", func(c *gin.Context) {
+		logger(c.Request.Context()).Info("new server", "server", c.Param("address"))
+		c.Status(http.StatusNoContent)
+	})
+
+	request := func(id string) string {
+		buf.Reset()
+
+		req := httptest.NewRequest(http.MethodGet, "/server/status/example.com", nil)
+		if id != "" {
+			req.Header.Set(requestIDHeader, id)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var lines []map[string]interface{}
+
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var line map[string]interface{}
+			if err := dec.Decode(&line); err != nil {
+				t.Fatal(err)
+			}
+
+			lines = append(lines, line)
+		}
+
+		if len(lines) != 2 {
+			t.Fatalf("expected a handler and an access log line, got %v", lines)
+		}
+
+		for _, line := range lines {
+			if line["request_id"] != w.Header().Get(requestIDHeader) {
+				t.Errorf("expected %v to have request ID %s", line, w.Header().Get(requestIDHeader))
+			}
+		}
+
+		if access := lines[1]; access["route"] != "/server/status/:address" || access["status"] != float64(http.StatusNoContent) {
+			t.Errorf("unexpected access log %v", access)
+		}
+
+		return w.Header().Get(requestIDHeader)
+	}
+
+	if id := request(""); len(id) != 16 {
+		t.Errorf("expected a request ID to be generated, got %q", id)
+	}
+
+	if id := request("abc-123"); id != "abc-123" {
+		t.Errorf("expected the client's request ID to be used, got %q", id)
+	}
+
+	if id := request("bad id\n"); id == "bad id\n" {
+		t.Error("expected an unsafe request ID to be replaced")
+	}
+}
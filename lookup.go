@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	errInvalidAddress = "invalid hostname or port"
+	errBusy           = "too many pending requests"
+	errRateLimited    = "too many invalid requests"
+)
+
+// lookupError is a reason a server could not be looked up, along with the
+// HTTP status and error code it should be reported with.
+type lookupError struct {
+	Status   int
+	Code     types.ErrorCode
+	Message  string
+	TryAfter int
+}
+
+func (e *lookupError) Error() string {
+	return e.Message
+}
+
+func (e *lookupError) v2() *types.ErrorV2 {
+	return &types.ErrorV2{
+		Code:     e.Code,
+		Message:  e.Message,
+		TryAfter: e.TryAfter,
+	}
+}
+
+var errLookupBusy = &lookupError{
+	Status:  http.StatusServiceUnavailable,
+	Code:    types.ErrorUnavailable,
+	Message: errBusy,
+}
+
+func rateLimitedError(count int) *lookupError {
+	return &lookupError{
+		Status:   http.StatusTooManyRequests,
+		Code:     types.ErrorRateLimited,
+		Message:  errRateLimited,
+		TryAfter: count / rateLimitThreshold,
+	}
+}
+
+// probeFailure describes a failed ping or query from the error it recorded.
+func probeFailure(message string) *lookupError {
+	if message == errInvalidAddress {
+		return &lookupError{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    types.ErrorInvalidAddress,
+			Message: message,
+		}
+	}
+
+	return &lookupError{
+		Status:  http.StatusServiceUnavailable,
+		Code:    types.ErrorUnavailable,
+		Message: message,
+	}
+}
+
+// lookupCache gets a server from a cache, recording whether it was found.
+func lookupCache(ctx context.Context, name string, cache *serverCache, serverAddr string) (interface{}, bool) {
+	_, span := tracer.Start(ctx, "cache lookup", trace.WithAttributes(
+		attribute.String("mcapi.cache", name),
+		attribute.String("mcapi.server", serverAddr),
+	))
+	defer span.End()
+
+	value, ok := cache.GetOK(serverAddr)
+	span.SetAttributes(attribute.String("mcapi.cache.result", observeCacheLookup(name, value, ok)))
+
+	return value, ok
+}
+
+// lookupStatus returns the cached status of a server, pinging it in the
+// interactive lane if it is not cached. If the ping fails, the status
+// recording the failure is returned along with the error.
+func lookupStatus(ctx context.Context, serverAddr, ip string) (*types.ServerStatus, *lookupError) {
+	serverAddr = strings.ToLower(serverAddr)
+
+	status, ok := lookupCache(ctx, eventStatus, pingMap, serverAddr)
+
+	if ok {
+		return status.(*types.ServerStatus), nil
+	}
+
+	logger(ctx).Info("new server", "server", serverAddr, "requester", ip)
+
+	if limit, count := shouldRateLimit(ctx, ip); limit {
+		return nil, rateLimitedError(count)
+	}
+
+	return probeStatus(ctx, serverAddr, ip)
+}
+
+// probeStatus pings a server in the interactive lane, whether or not it
+// is cached.
+func probeStatus(ctx context.Context, serverAddr, ip string) (*types.ServerStatus, *lookupError) {
+	ctx, cancel := context.WithTimeout(ctx, statusTimeout)
+	defer cancel()
+
+	var status *types.ServerStatus
+
+	err := interactiveLane.run(ctx, time.Now(), func() {
+		status = updatePing(ctx, serverAddr)
+	})
+
+	if err != nil {
+		return nil, errLookupBusy
+	}
+
+	if status.Error != "" {
+		incrRateLimit(ip)
+
+		return status, probeFailure(status.Error)
+	}
+
+	return status, nil
+}
+
+// lookupQuery returns the cached query of a server, querying it in the
+// interactive lane if it is not cached. If the query fails, the result
+// recording the failure is returned along with the error.
+func lookupQuery(ctx context.Context, serverAddr, ip string) (*types.ServerQuery, *lookupError) {
+	serverAddr = strings.ToLower(serverAddr)
+
+	query, ok := lookupCache(ctx, eventQuery, queryMap, serverAddr)
+
+	if ok {
+		return query.(*types.ServerQuery), nil
+	}
+
+	logger(ctx).Info("new server", "server", serverAddr, "requester", ip)
+
+	if limit, count := shouldRateLimit(ctx, ip); limit {
+		return nil, rateLimitedError(count)
+	}
+
+	return probeQuery(ctx, serverAddr, ip)
+}
+
+// probeQuery queries a server in the interactive lane, whether or not it
+// is cached.
+func probeQuery(ctx context.Context, serverAddr, ip string) (*types.ServerQuery, *lookupError) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var query *types.ServerQuery
+
+	err := interactiveLane.run(ctx, time.Now(), func() {
+		query = updateQuery(ctx, serverAddr)
+	})
+
+	if err != nil {
+		return nil, errLookupBusy
+	}
+
+	if query.Error != "" {
+		incrRateLimit(ip)
+
+		return query, probeFailure(query.Error)
+	}
+
+	return query, nil
+}
+
+// errorResponse is the body of a failed v1 request.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// rateLimitedResponse is the body of a v1 request which was rate limited.
+type rateLimitedResponse struct {
+	Error    string `json:"error"`
+	TryAfter int    `json:"try_after"`
+}
+
+// abortLookup responds to a failed lookup with the original error body.
+func abortLookup(c *gin.Context, err *lookupError) {
+	if err.Code == types.ErrorRateLimited {
+		abortRender(c, err.Status, &rateLimitedResponse{
+			Error:    err.Message,
+			TryAfter: err.TryAfter,
+		})
+		return
+	}
+
+	abortRender(c, err.Status, &errorResponse{
+		Error: err.Message,
+	})
+}
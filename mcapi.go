@@ -1,23 +1,23 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"flag"
-	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
 	"time"
 
-	"github.com/OneOfOne/cmap/stringcmap"
 	"github.com/gomodule/redigo/redis"
 	"github.com/getsentry/raven-go"
 	"github.com/gin-contrib/sentry"
 	"github.com/gin-gonic/gin"
-	"github.com/gocraft/work"
 	"github.com/syfaro/mcapi/types"
 )
 
@@ -28,14 +28,114 @@ type Config struct {
 	TemplateFile string
 	SentryDSN    string
 	AdminKey     string
+
+	// StatusTimeout and QueryTimeout are the number of seconds a single
+	// ping or query may take before it is abandoned.
+	StatusTimeout int
+	QueryTimeout  int
+
+	// InteractiveWorkers is the number of workers reserved for refreshes
+	// requested by users, and BulkWorkers the number used for scheduled
+	// refreshes of every tracked server.
+	InteractiveWorkers int
+	BulkWorkers        int
+
+	// Standalone runs the job queue and counters in process instead of
+	// in Redis. If StateFile is set, they are saved there periodically
+	// and restored on startup.
+	Standalone bool
+	StateFile  string
+
+	// CacheMaxEntries and CacheMaxBytes limit the number of servers and the
+	// approximate memory held by each of the status and query caches.
+	// Zero means no limit.
+	CacheMaxEntries int
+	CacheMaxBytes   int64
+
+	// BatchMaxAddresses is the most servers a batch request may include,
+	// and BatchWorkers how many of them are pinged at once.
+	BatchMaxAddresses int
+	BatchWorkers      int
+
+	// WebSocketMaxPerIP is the most WebSocket connections allowed from
+	// one IP address.
+	WebSocketMaxPerIP int
+
+	// WebhookFile is where webhooks are saved. If empty, webhooks are
+	// lost on restart. WebhookMax is the most webhooks which may exist.
+	// WebhookKey is the secret each webhook's secret is derived from. If
+	// empty, a random key is used and webhook secrets change on restart.
+	WebhookFile string
+	WebhookMax  int
+	WebhookKey  string
+
+	// APIKeyFile is where API keys and their usage are saved. If empty,
+	// keys are lost on restart.
+	APIKeyFile string
+
+	// DiscordPublicKey is the hex encoded public key of the Discord
+	// application, and SlackSigningSecret the signing secret of the Slack
+	// app, used to verify slash commands. PublicURL is where this API can
+	// be reached, for linking images in replies.
+	DiscordPublicKey   string
+	SlackSigningSecret string
+	PublicURL          string
+
+	// HistoryHours is how many hours of status history are kept for each
+	// server.
+	HistoryHours int
+
+	// DefaultIcon is the PNG image served by /server/icon for servers
+	// without an icon. If empty, a grass block is used.
+	DefaultIcon string
+
+	// GRPCHost is the address to serve the gRPC API on. If empty, it is
+	// not served.
+	GRPCHost string
+
+	// TrustedProxies are the addresses or CIDR ranges of proxies in front
+	// of the API, such as Cloudflare's, whose CF-Connecting-IP or
+	// X-Forwarded-For headers are used for the client's address. Requests
+	// from anywhere else are identified by their own address, and a
+	// warning is logged if they have these headers while none are trusted.
+	TrustedProxies []string
+
+	// MetricsAuth requires the admin credentials to read /metrics and
+	// /probe.
+	MetricsAuth bool
+
+	// MonitoredServers are the servers exported by /metrics/servers.
+	MonitoredServers []string
+
+	// LogLevel is the least severe level logged: debug, info, warn or
+	// error. LogFormat is text for logfmt style lines, or json.
+	LogLevel  string
+	LogFormat string
+
+	// LogFile is where logs are written as well as stdout. If empty, logs
+	// are only written to stdout. The file is rotated once it reaches
+	// LogMaxSizeMB, keeping LogMaxBackups old files for LogMaxAgeDays.
+	LogFile       string
+	LogMaxSizeMB  int
+	LogMaxBackups int
+	LogMaxAgeDays int
+
+	// TraceExporter is where traces are sent: otlp for an OTLP collector
+	// over gRPC at TraceEndpoint, or stdout. If empty, nothing is traced.
+	// TraceInsecure connects to the collector without TLS.
+	TraceExporter string
+	TraceEndpoint string
+	TraceInsecure bool
+
+	// TraceSampleRatio is the fraction of requests traced, unless the
+	// caller's trace was sampled. Zero traces every request.
+	TraceSampleRatio float64
 }
 
 var redisPool *redis.Pool
 
-var enqueuer *work.Enqueuer
-
-var pingMap *stringcmap.CMap
-var queryMap *stringcmap.CMap
+var pingMap *serverCache
+var queryMap *serverCache
 
 func loadConfig(path string) *Config {
 	file, err := ioutil.ReadFile(path)
@@ -58,6 +158,34 @@ func generateConfig(path string) {
 		StaticFiles:  "./scripts",
 		TemplateFile: "./templates/index.html",
 		AdminKey:     "your_secret",
+
+		TrustedProxies: []string{},
+
+		StatusTimeout: 5,
+		QueryTimeout:  5,
+
+		InteractiveWorkers: defaultInteractiveWorkers,
+		BulkWorkers:        defaultBulkWorkers,
+
+		CacheMaxEntries: 50000,
+		CacheMaxBytes:   256 << 20,
+
+		BatchMaxAddresses: defaultBatchMaxAddresses,
+		BatchWorkers:      defaultBatchWorkers,
+
+		WebSocketMaxPerIP: defaultWebSocketMaxPerIP,
+
+		WebhookMax: defaultWebhookMax,
+		WebhookKey: randomHex(32),
+
+		HistoryHours: int(defaultHistoryRetention / time.Hour),
+
+		LogLevel:      "info",
+		LogFormat:     logFormatText,
+		LogFile:       "mcapi.log",
+		LogMaxSizeMB:  100,
+		LogMaxBackups: 5,
+		LogMaxAgeDays: 30,
 	}
 
 	data, err := json.MarshalIndent(cfg, "", "	")
@@ -79,124 +207,208 @@ var fatalServerErrors = []string{
 	"invalid argument",
 }
 
-func updateServers() {
-	pingMap.ForEachLocked(func(key string, _ interface{}) bool {
-		enqueuer.Enqueue("status", work.Q{"serverAddr": key})
+func main() {
+	configFile := flag.String("config", "config.json", "path to configuration file")
+	genConfig := flag.Bool("gencfg", false, "generate configuration file with sane defaults")
+	fetch := flag.Bool("fetch", true, "enable fetching server data")
 
-		return true
-	})
+	flag.Parse()
 
-	queryMap.ForEachLocked(func(key string, _ interface{}) bool {
-		enqueuer.Enqueue("query", work.Q{"serverAddr": key})
+	if *genConfig {
+		generateConfig(*configFile)
+		slog.Info("saved configuration file with sane defaults, please update as needed", "path", *configFile)
+		os.Exit(0)
+	}
 
-		return true
-	})
-}
+	cfg := loadConfig(*configFile)
 
-type JobCtx struct{}
+	if err := setupLogging(cfg); err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		panic(err)
+	}
 
-func jobMiddleware(job *work.Job, next work.NextMiddlewareFunc) error {
-	log.Printf("Running %s: %+v\n", job.Name, job.Args)
-	return next()
-}
+	shutdownTracing, err := setupTracing(cfg)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		panic(err)
+	}
+	defer shutdownTracing(context.Background())
 
-func jobUpdate(job *work.Job) error {
-	e := make(chan error, 1)
-
-	go func() {
-		if _, ok := job.Args["serverAddr"]; ok {
-			serverAddr := job.ArgString("serverAddr")
-
-			if job.Name == "query" {
-				res := updateQuery(serverAddr)
-
-				if res.Error != "" {
-					e <- errors.New(res.Error)
-				} else {
-					e <- nil
-				}
-			} else if job.Name == "status" {
-				res := updatePing(serverAddr)
-
-				if res.Error != "" {
-					e <- errors.New(res.Error)
-				} else {
-					e <- nil
-				}
-			}
-		} else {
-			e <- errors.New("missing server address")
+	raven.SetDSN(cfg.SentryDSN)
+
+	if cfg.StatusTimeout > 0 {
+		statusTimeout = time.Duration(cfg.StatusTimeout) * time.Second
+	}
+
+	if cfg.QueryTimeout > 0 {
+		queryTimeout = time.Duration(cfg.QueryTimeout) * time.Second
+	}
+
+	if cfg.BatchMaxAddresses > 0 {
+		batchMaxAddresses = cfg.BatchMaxAddresses
+	}
+
+	if cfg.BatchWorkers > 0 {
+		batchWorkers = cfg.BatchWorkers
+	}
+
+	if cfg.WebSocketMaxPerIP > 0 {
+		webSocketMaxPerIP = cfg.WebSocketMaxPerIP
+	}
+
+	if cfg.WebhookMax > 0 {
+		webhookMax = cfg.WebhookMax
+	}
+
+	if cfg.HistoryHours > 0 {
+		history.retention = time.Duration(cfg.HistoryHours) * time.Hour
+	}
+
+	go history.expire()
+
+	if cfg.InteractiveWorkers > 0 {
+		interactiveLane = newLane(laneInteractive, cfg.InteractiveWorkers)
+		batchSlots = newBatchSlots(interactiveLane)
+	}
+
+	if cfg.BulkWorkers > 0 {
+		bulkLane = newLane(laneBulk, cfg.BulkWorkers)
+	}
+
+	if cfg.WebhookFile != "" {
+		if err := webhooks.load(cfg.WebhookFile); err != nil {
+			raven.CaptureErrorAndWait(err, nil)
+			panic(err)
 		}
-	}()
+	}
 
-	select {
-	case res := <-e:
-		return res
-	case <-time.After(5 * time.Second):
-		return errors.New("job took longer than 5 seconds")
+	if cfg.WebhookKey != "" {
+		webhookKey = []byte(cfg.WebhookKey)
+	} else if cfg.WebhookFile != "" {
+		slog.Warn("WebhookKey is not set, so webhook secrets will change on restart")
 	}
-}
 
-func main() {
-	configFile := flag.String("config", "config.json", "path to configuration file")
-	genConfig := flag.Bool("gencfg", false, "generate configuration file with sane defaults")
-	fetch := flag.Bool("fetch", true, "enable fetching server data")
+	events.listen(deliverWebhooks)
+	startWebhookWorkers()
 
-	flag.Parse()
+	if cfg.APIKeyFile != "" {
+		if err := apiKeys.load(cfg.APIKeyFile); err != nil {
+			raven.CaptureErrorAndWait(err, nil)
+			panic(err)
+		}
 
-	f, _ := os.OpenFile("mcapi.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	defer f.Close()
+		go apiKeys.persist()
+	}
 
-	log.SetOutput(io.MultiWriter(f, os.Stdout))
+	if cfg.DiscordPublicKey != "" {
+		key, err := hex.DecodeString(cfg.DiscordPublicKey)
+		if err == nil && len(key) != ed25519.PublicKeySize {
+			err = errors.New("DiscordPublicKey must be an Ed25519 public key")
+		}
 
-	if *genConfig {
-		generateConfig(*configFile)
-		log.Println("Saved configuration file with sane defaults, please update as needed")
-		os.Exit(0)
+		if err != nil {
+			raven.CaptureErrorAndWait(err, nil)
+			panic(err)
+		}
+
+		discordPublicKey = key
 	}
 
-	cfg := loadConfig(*configFile)
+	if cfg.DefaultIcon != "" {
+		defaultIcon = cfg.DefaultIcon
+	}
 
-	raven.SetDSN(cfg.SentryDSN)
+	for _, address := range cfg.MonitoredServers {
+		serverAddr, err := parseAddress(address)
+		if err != nil {
+			raven.CaptureErrorAndWait(err, nil)
+			panic(err)
+		}
 
-	pingMap = stringcmap.New()
-	queryMap = stringcmap.New()
-
-	redisPool = &redis.Pool{
-		MaxActive:   200,
-		MaxIdle:     100,
-		Wait:        true,
-		IdleTimeout: 60 * time.Second,
-		Dial: func() (redis.Conn, error) {
-			return redis.Dial("tcp", cfg.RedisHost)
-		},
+		monitoredServers = append(monitoredServers, serverAddr)
 	}
 
-	if *fetch {
-		log.Println("Fetching enabled.")
+	slackSigningSecret = []byte(cfg.SlackSigningSecret)
+	publicURL = cfg.PublicURL
+
+	pingMap = newServerCache(cfg.CacheMaxEntries, cfg.CacheMaxBytes)
+	queryMap = newServerCache(cfg.CacheMaxEntries, cfg.CacheMaxBytes)
+
+	var queue jobQueue
+
+	if cfg.Standalone {
+		slog.Info("running standalone, without Redis")
 
-		enqueuer = work.NewEnqueuer("mcapi", redisPool)
+		requests := &memoryCounter{}
+		memoryQueue := newMemoryJobQueue()
+
+		if cfg.StateFile != "" {
+			loadState(cfg.StateFile, memoryQueue, requests)
+			go persistState(cfg.StateFile, memoryQueue, requests)
+		}
+
+		requestCounter = requests
+		queue = memoryQueue
+	} else {
+		redisPool = &redis.Pool{
+			MaxActive:   200,
+			MaxIdle:     100,
+			Wait:        true,
+			IdleTimeout: 60 * time.Second,
+			Dial: func() (redis.Conn, error) {
+				return redis.Dial("tcp", cfg.RedisHost)
+			},
+		}
+
+		requestCounter = &redisCounter{pool: redisPool, key: "mcapi"}
+		queue = newRedisJobQueue(redisPool)
+	}
 
-		pool := work.NewWorkerPool(JobCtx{}, 50, "mcapi", redisPool)
+	if *fetch {
+		slog.Info("fetching enabled")
 
-		pool.Middleware(jobMiddleware)
+		jobs = queue
 
-		pool.Job("query", jobUpdate)
-		pool.Job("status", jobUpdate)
+		jobs.startLane(interactiveLane)
+		jobs.startLane(bulkLane)
 
-		go pool.Start()
+		go monitorQueues()
 
 		updateServers()
 		go func() {
-			for range time.Tick(time.Minute * 5) {
+			for range time.Tick(updateInterval) {
 				updateServers()
 			}
 		}()
 	} else {
-		log.Println("Fetching is NOT enabled.")
+		slog.Warn("fetching is NOT enabled")
+	}
+
+	router := newRouter(cfg)
+
+	if cfg.GRPCHost != "" {
+		go serveGRPC(cfg.GRPCHost)
 	}
 
+	router.Run(cfg.HttpAppHost)
+}
+
+// newRouter creates the router with every HTTP route.
+func newRouter(cfg *Config) *gin.Engine {
 	router := gin.New()
+
+	if err := trustProxies(router, cfg.TrustedProxies); err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		panic(err)
+	}
+
+	if len(cfg.TrustedProxies) == 0 {
+		router.Use(warnProxyHeaders)
+	}
+
+	router.Use(traceRequests)
+	router.Use(logRequests)
+	router.Use(instrumentRequests)
 	router.Use(sentry.Recovery(raven.DefaultClient, false))
 
 	router.Static("/scripts", cfg.StaticFiles)
@@ -206,26 +418,42 @@ func main() {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET")
-		c.Writer.Header().Set("Cache-Control", "max-age=300, public, s-maxage=300")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE")
 
-		r := redisPool.Get()
-		r.Do("INCR", "mcapi")
-		r.Close()
+		_, span := tracer.Start(c.Request.Context(), "count request")
+		requestCounter.incr()
+		span.End()
 	})
 
+	router.Use(checkAPIKey)
+
 	router.GET("/", func(c *gin.Context) {
-		c.HTML(http.StatusOK, "index.html", gin.H{})
+		c.HTML(http.StatusOK, "index.html", gin.H{
+			"Fields": openAPISpec.schemaFields("ServerStatus"),
+			"Routes": openAPISpec.routes(),
+		})
 	})
 
+	router.GET("/openapi.json", respondOpenAPI)
+
 	router.GET("/health", func (c *gin.Context) {
 		c.String(http.StatusOK, ":3")
 	})
 
-	router.GET("/stats", func(c *gin.Context) {
-		r := redisPool.Get()
-		stats, err := redis.Int64(r.Do("GET", "mcapi"))
-		r.Close()
+	metrics := router.Group("/", noStore)
+	if cfg.MetricsAuth {
+		metrics.Use(gin.BasicAuth(gin.Accounts{
+			"mcapi": cfg.AdminKey,
+		}))
+	}
+
+	metrics.GET("/metrics", respondMetrics)
+	metrics.GET("/probe", respondProbe)
+
+	router.GET("/metrics/servers", noStore, respondMonitoredServers)
+
+	router.GET("/stats", noStore, func(c *gin.Context) {
+		stats, err := requestCounter.get()
 
 		if err != nil {
 			raven.CaptureErrorAndWait(err, nil)
@@ -238,14 +466,39 @@ func main() {
 	})
 
 	router.GET("/server/status", respondServerStatus)
+	router.GET("/server/status/:address", respondServerStatus)
 	router.GET("/minecraft/1.3/server/status", respondServerStatus)
 
+	router.GET("/server/status/batch", respondServerStatusBatch)
+	router.POST("/server/status/batch", respondServerStatusBatch)
+
+	router.GET("/server/events", respondServerEvents)
+	router.GET("/ws", respondWebSocket)
+
 	router.GET("/server/image", respondServerImage)
+	router.GET("/server/image/:address", respondServerImage)
+	router.GET("/server/icon/:address", respondServerIcon)
+
+	router.POST("/server/refresh", noStore, respondRefresh)
+	router.POST("/server/verify", noStore, respondVerifyOwner)
 
 	router.GET("/server/query", respondServerQuery)
+	router.GET("/server/query/:address", respondServerQuery)
 	router.GET("/minecraft/1.3/server/query", respondServerQuery)
 
-	authorized := router.Group("/admin", gin.BasicAuth(gin.Accounts{
+	registerV2(router)
+
+	router.GET("/graphql", respondGraphQL)
+	router.POST("/graphql", respondGraphQL)
+
+	router.POST("/webhooks", noStore, respondCreateWebhook)
+	router.GET("/webhooks/:id", noStore, respondWebhook)
+	router.DELETE("/webhooks/:id", noStore, respondDeleteWebhook)
+
+	router.POST("/interactions/discord", noStore, respondDiscordInteraction)
+	router.POST("/interactions/slack", noStore, respondSlackCommand)
+
+	authorized := router.Group("/admin", noStore, gin.BasicAuth(gin.Accounts{
 		"mcapi": cfg.AdminKey,
 	}))
 
@@ -289,6 +542,16 @@ func main() {
 		c.String(http.StatusOK, items.String())
 	})
 
+	authorized.GET("/jobs", respondJobQueues)
+	authorized.GET("/lanes", respondLanes)
+	authorized.GET("/cache", respondCacheStats)
+	authorized.GET("/webhooks", respondAdminWebhooks)
+	authorized.GET("/keys", respondAPIKeys)
+	authorized.POST("/keys", respondCreateAPIKey)
+	authorized.GET("/keys/:id", respondAPIKey)
+	authorized.DELETE("/keys/:id", respondRevokeAPIKey)
+	authorized.POST("/refresh", respondAdminRefresh)
+
 	authorized.POST("/clear", func(c *gin.Context) {
 		pingMap.ForEach(func(key string, _ interface{}) bool {
 			pingMap.Delete(key)
@@ -303,5 +566,5 @@ func main() {
 		c.String(http.StatusOK, "Cleared items.")
 	})
 
-	router.Run(cfg.HttpAppHost)
+	return router
 }
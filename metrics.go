@@ -0,0 +1,208 @@
+package main
+
+import (
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/syfaro/mcapi/types"
+)
+
+const (
+	probeOutcomeOnline  = "online"
+	probeOutcomeOffline = "offline"
+	probeOutcomeError   = "error"
+
+	cacheHit   = "hit"
+	cacheMiss  = "miss"
+	cacheStale = "stale"
+
+	rateLimitIP            = "ip"
+	rateLimitKeyQuota      = "key_quota"
+	rateLimitKeyBurst      = "key_burst"
+	rateLimitRefreshServer = "refresh_server"
+	rateLimitRefreshCaller = "refresh_caller"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcapi_http_requests_total",
+		Help: "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mcapi_http_request_duration_seconds",
+		Help:    "Time taken to respond to HTTP requests by route, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	probes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcapi_probes_total",
+		Help: "Pings and queries of servers by kind, outcome and error code.",
+	}, []string{"kind", "outcome", "code"})
+
+	probeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mcapi_probe_duration_seconds",
+		Help:    "Time taken to ping or query servers by kind and outcome.",
+		Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"kind", "outcome"})
+
+	cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcapi_cache_lookups_total",
+		Help: "Cache lookups by cache and result, which is hit, miss or stale.",
+	}, []string{"cache", "result"})
+
+	rateLimitRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcapi_rate_limit_rejections_total",
+		Help: "Requests rejected by a rate limit, by which limit.",
+	}, []string{"reason"})
+
+	webhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcapi_webhook_deliveries_total",
+		Help: "Webhook delivery attempts by event and outcome.",
+	}, []string{"event", "outcome"})
+)
+
+func init() {
+	prometheus.MustRegister(&stateCollector{})
+}
+
+// requestRoute is the pattern a request matched, so addresses don't create
+// new series or span names.
+func requestRoute(c *gin.Context) string {
+	if route := c.FullPath(); route != "" {
+		return route
+	}
+
+	return "unmatched"
+}
+
+// instrumentRequests records the count and duration of every request.
+func instrumentRequests(c *gin.Context) {
+	started := time.Now()
+
+	c.Next()
+
+	route := requestRoute(c)
+	status := strconv.Itoa(c.Writer.Status())
+
+	httpRequests.WithLabelValues(route, c.Request.Method, status).Inc()
+	httpDuration.WithLabelValues(route, c.Request.Method, status).Observe(time.Since(started).Seconds())
+}
+
+// observeProbe records a finished ping or query. errorMessage is the error
+// it recorded, if any.
+func observeProbe(kind string, online bool, errorMessage string, took time.Duration) {
+	outcome, code := probeOutcomeOffline, ""
+
+	switch {
+	case errorMessage != "":
+		outcome, code = probeOutcomeError, string(probeFailure(errorMessage).Code)
+	case online:
+		outcome = probeOutcomeOnline
+	}
+
+	probes.WithLabelValues(kind, outcome, code).Inc()
+	probeDuration.WithLabelValues(kind, outcome).Observe(took.Seconds())
+}
+
+// observeCacheLookup records whether a server was found in a cache, and
+// if it was, whether it had missed an update.
+func observeCacheLookup(cache string, value interface{}, ok bool) string {
+	result := cacheMiss
+
+	if ok {
+		result = cacheHit
+
+		var lastUpdated string
+
+		switch v := value.(type) {
+		case *types.ServerStatus:
+			lastUpdated = v.LastUpdated
+		case *types.ServerQuery:
+			lastUpdated = v.LastUpdated
+		}
+
+		if updated := parseLastUpdated(lastUpdated); !updated.IsZero() && time.Since(updated) > updateInterval {
+			result = cacheStale
+		}
+	}
+
+	cacheLookups.WithLabelValues(cache, result).Inc()
+
+	return result
+}
+
+var (
+	cacheEntriesDesc = prometheus.NewDesc("mcapi_cache_entries",
+		"Servers held in each cache.", []string{"cache"}, nil)
+	cacheBytesDesc = prometheus.NewDesc("mcapi_cache_bytes",
+		"Approximate memory held by each cache.", []string{"cache"}, nil)
+	cacheEvictionsDesc = prometheus.NewDesc("mcapi_cache_evictions_total",
+		"Servers evicted from each cache to stay within its limits.", []string{"cache"}, nil)
+	queueDepthDesc = prometheus.NewDesc("mcapi_job_queue_depth",
+		"Jobs waiting in each queue.", []string{"queue"}, nil)
+	queueLatencyDesc = prometheus.NewDesc("mcapi_job_queue_latency_seconds",
+		"How long the oldest job in each queue has been waiting.", []string{"queue"}, nil)
+	laneActiveDesc = prometheus.NewDesc("mcapi_lane_active_workers",
+		"Probes running in each lane.", []string{"lane"}, nil)
+	laneCapacityDesc = prometheus.NewDesc("mcapi_lane_capacity_workers",
+		"Most probes which may run at once in each lane.", []string{"lane"}, nil)
+	laneCompletedDesc = prometheus.NewDesc("mcapi_lane_completed_total",
+		"Probes completed in each lane.", []string{"lane"}, nil)
+)
+
+// stateCollector reports the current size of the caches, job queues and
+// lanes whenever metrics are scraped.
+type stateCollector struct{}
+
+func (stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		cacheEntriesDesc, cacheBytesDesc, cacheEvictionsDesc,
+		queueDepthDesc, queueLatencyDesc,
+		laneActiveDesc, laneCapacityDesc, laneCompletedDesc,
+	} {
+		ch <- desc
+	}
+}
+
+func (stateCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, cache := range map[string]*serverCache{eventStatus: pingMap, eventQuery: queryMap} {
+		if cache == nil {
+			continue
+		}
+
+		stats := cache.stats()
+
+		ch <- prometheus.MustNewConstMetric(cacheEntriesDesc, prometheus.GaugeValue, float64(stats.Entries), name)
+		ch <- prometheus.MustNewConstMetric(cacheBytesDesc, prometheus.GaugeValue, float64(stats.Bytes), name)
+		ch <- prometheus.MustNewConstMetric(cacheEvictionsDesc, prometheus.CounterValue, float64(stats.Evictions), name)
+	}
+
+	if jobs != nil {
+		queues, err := jobs.queues()
+		if err != nil {
+			slog.Error("unable to load job queues for metrics", "err", err)
+		}
+
+		for _, queue := range queues {
+			ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(queue.Count), queue.JobName)
+			ch <- prometheus.MustNewConstMetric(queueLatencyDesc, prometheus.GaugeValue, float64(queue.Latency), queue.JobName)
+		}
+	}
+
+	for _, l := range []*lane{interactiveLane, bulkLane} {
+		stats := l.stats()
+
+		ch <- prometheus.MustNewConstMetric(laneActiveDesc, prometheus.GaugeValue, float64(stats.Active), stats.Name)
+		ch <- prometheus.MustNewConstMetric(laneCapacityDesc, prometheus.GaugeValue, float64(stats.Capacity), stats.Name)
+		ch <- prometheus.MustNewConstMetric(laneCompletedDesc, prometheus.CounterValue, float64(stats.Completed), stats.Name)
+	}
+}
+
+// respondMetrics serves every metric in the Prometheus text format.
+var respondMetrics = gin.WrapH(promhttp.Handler())
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	requestCounter = &memoryCounter{}
+
+	router := newRouter(&Config{
+		StaticFiles:  "./scripts",
+		TemplateFile: "templates/index.html",
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	observeProbe(eventStatus, false, errInvalidAddress, time.Millisecond)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected metrics to be served, got %d", w.Code)
+	}
+
+	body, _ := io.ReadAll(w.Body)
+
+	for _, want := range []string{
+		`mcapi_http_requests_total{method="GET",route="/health",status="200"}`,
+		`mcapi_probes_total{code="invalid_address",kind="status",outcome="error"}`,
+		`mcapi_lane_capacity_workers{lane="interactive"}`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected metrics to include %s", want)
+		}
+	}
+}
+
+func TestMetricsAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	requestCounter = &memoryCounter{}
+
+	router := newRouter(&Config{
+		StaticFiles:  "./scripts",
+		TemplateFile: "templates/index.html",
+		AdminKey:     "secret",
+		MetricsAuth:  true,
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected metrics to require the admin key, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.SetBasicAuth("mcapi", "secret")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected metrics with the admin key, got %d", w.Code)
+	}
+}
@@ -0,0 +1,1012 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+)
+
+// openAPIDocument is an OpenAPI 3 document, with only the parts needed to
+// describe this API.
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+	Security   []map[string][]string                   `json:"security,omitempty"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema         `json:"schemas"`
+	SecuritySchemes map[string]*openAPISecurityScheme `json:"securitySchemes"`
+}
+
+type openAPISecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	Name        string `json:"name,omitempty"`
+	In          string `json:"in,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type openAPIOperation struct {
+	Summary     string                      `json:"summary"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Deprecated  bool                        `json:"deprecated,omitempty"`
+	Parameters  []*openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                         `json:"required,omitempty"`
+	Content  map[string]*openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	AllOf                []*openAPISchema          `json:"allOf,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+	Example              interface{}               `json:"example,omitempty"`
+}
+
+// schemaDocs describes fields of the response types. Keys are either
+// Type.field for a field of one type, or field for every field with that
+// name.
+var schemaDocs = map[string]string{
+	"address":          "the address of the server, including the port",
+	"status":           "the status of the request, success unless an error occurred. if this is not success, assume the data is bad and should not be used.",
+	"error":            "error message from the request. an invalid IP gives invalid hostname or port. empty means no error.",
+	"online":           "if the server is online or not",
+	"motd":             "the server description, also known as the message of the day. some strange formatting may be in this, there are various libraries available for formatting this.",
+	"motd_extra":       "the raw formatted parts of the description, if it has formatting",
+	"motd_formatted":   "the description as HTML, if it has formatting",
+	"favicon":          "the server icon as a data URI of a PNG image",
+	"players":          "the number of players on the server",
+	"max":              "number of players that the server will allow",
+	"now":              "number of players currently online",
+	"list":             "names of the players currently online",
+	"server":           "the server version",
+	"name":             "current server version name",
+	"protocol":         "server version protocol",
+	"last_online":      "the date the server was last recorded online. if empty, it has never been online. it is a unix timestamp in string form. if this has the same value as last_updated, it means that it is currently online.",
+	"last_updated":     "the date the status of the server was last updated at, as a unix timestamp in string form. it updates every five minutes, so you may send requests as soon as it has expired.",
+	"duration":         "the time it took to process the original request, in nanoseconds",
+	"version":          "the server version",
+	"game_type":        "the game type, normally SMP",
+	"game_id":          "the game, normally MINECRAFT",
+	"server_mod":       "the server software and version",
+	"map":              "the name of the world",
+	"plugins":          "the installed plugins",
+	"servers":          "the result for each server, keyed by address",
+	"errors":           "why each server which failed could not be checked, keyed by address",
+	"code":             "why the request failed",
+	"message":          "a description of the error",
+	"try_after":        "the number of seconds to wait before retrying, when rate limited",
+	"duration_ms":      "the time it took to check the server, in milliseconds",
+	"kind":             "whether the event is for a status or a query",
+	"changes":          "which of online, players, motd, version and plugins changed. every field is included for the first event of a server.",
+	"addresses":        "the servers to look up",
+	"url":              "the URL deliveries are posted to",
+	"events":           "the events which are delivered: offline, online, players_above, players_below, motd and version",
+	"player_threshold": "the player count for players_above and players_below events",
+	"format":           "default, or discord to post Discord webhook messages",
+	"id":               "the ID of the webhook",
+	"secret":           "the secret deliveries are signed with, and which authorizes viewing and deleting the webhook. it is only included when the webhook is created.",
+	"created":          "when the webhook was created",
+	"creator":          "a hash of the caller which created the webhook",
+	"disabled":         "if the webhook was disabled after too many failed deliveries",
+	"disabled_reason":  "why the webhook was disabled",
+	"failures":         "how many deliveries in a row have failed",
+	"deliveries":       "the most recent delivery attempts",
+	"timestamp":        "when the event happened",
+	"query":            "a GraphQL query",
+	"operationName":    "which operation in the query to run",
+	"variables":        "values for the variables in the query",
+
+	"ApiKey.id":                        "the ID of the key",
+	"ApiKey.name":                      "who the key was issued to",
+	"ApiKey.tier":                      "the tier the key's default limits came from",
+	"ApiKey.key":                       "the key, only included when it is created",
+	"ApiKey.hash":                      "the SHA-256 hash of the key, which is never included in responses",
+	"ApiKey.created":                   "when the key was created",
+	"ApiKey.revoked":                   "when the key was revoked, if it was",
+	"ApiKey.usage":                     "the number of requests made each day, keyed by UTC date",
+	"ApiKeyRequest.name":               "who the key is for",
+	"ApiKeyRequest.tier":               "free, standard or unlimited, which sets the limits which are not given. defaults to free.",
+	"daily_quota":                      "the most requests which may be made each UTC day, zero for no limit",
+	"per_minute":                       "the average number of requests which may be made each minute, zero for no limit",
+	"burst":                            "the most requests which may be made at once, defaults to per_minute",
+	"endpoints":                        "the path prefixes the key may be used for, like /v2/server. empty allows every endpoint.",
+	"origins":                          "the websites the key may be used from, like https://example.com. empty allows any.",
+	"OwnerVerification.verified":       "if the code was found in the MOTD",
+	"OwnerVerification.code":           "the code to add to the MOTD, until it has been found",
+	"OwnerVerification.nonce":          "the secret to send with the next request, only included when the code is first given",
+	"OwnerVerification.token":          "the owner token, once the code has been found",
+	"OwnerVerification.expires":        "when the code or token expires",
+	"ServerStatusV2.last_online":       "when the server was last recorded online, or null if it has never been online",
+	"ServerStatusV2.last_online_unix":  "last_online as a unix timestamp",
+	"ServerStatusV2.last_updated":      "when the status was last updated",
+	"ServerStatusV2.last_updated_unix": "last_updated as a unix timestamp",
+	"ServerQueryV2.last_online":        "when the server was last recorded online, or null if it has never been online",
+	"ServerQueryV2.last_online_unix":   "last_online as a unix timestamp",
+	"ServerQueryV2.last_updated":       "when the query was last updated",
+	"ServerQueryV2.last_updated_unix":  "last_updated as a unix timestamp",
+	"ErrorResponseV2.error":            "why the request failed",
+	"ServerStatusBatch.status":         "success, unless the whole request failed",
+	"ServerStatusBatch.error":          "why the whole request failed",
+	"ServerEvent.status":               "the new status, for status events",
+	"ServerEvent.query":                "the new query, for query events",
+	"WebhookDelivery.id":               "the ID of the delivery, shared by every attempt",
+	"WebhookDelivery.event":            "the event which was delivered",
+	"WebhookDelivery.attempt":          "which attempt this was, starting at 1",
+	"WebhookDelivery.time":             "when the attempt was made",
+	"WebhookDelivery.status_code":      "the HTTP status the webhook URL responded with",
+	"WebhookDelivery.error":            "why the attempt failed, empty if it succeeded",
+	"WebhookDelivery.duration_ms":      "how long the attempt took, in milliseconds",
+	"WebhookPayload.id":                "the ID of the delivery",
+	"WebhookPayload.event":             "the event which happened",
+	"WebhookPayload.status":            "the status of the server after the event",
+	"CacheStats.entries":               "the number of servers cached",
+	"CacheStats.max_entries":           "the most servers which may be cached, zero for no limit",
+	"CacheStats.bytes":                 "the approximate memory used",
+	"CacheStats.max_bytes":             "the most memory which may be used, zero for no limit",
+	"CacheStats.evictions":             "how many servers have been evicted",
+	"LaneStats.name":                   "interactive for requests from users, or bulk for scheduled refreshes",
+	"LaneStats.capacity":               "how many refreshes may run at once",
+	"LaneStats.active":                 "how many refreshes are running",
+	"LaneStats.completed":              "how many refreshes have finished",
+	"LaneStats.average_wait_ms":        "the average time refreshes waited to start, in milliseconds",
+	"LaneStats.average_run_ms":         "the average time refreshes took, in milliseconds",
+}
+
+// schemaExamples are example values for fields, keyed like schemaDocs.
+var schemaExamples = map[string]interface{}{
+	"ServerStatus.status":         "success",
+	"ServerStatus.online":         true,
+	"ServerStatus.motd":           "My Minecraft server",
+	"ServerStatusPlayers.max":     20,
+	"ServerStatusPlayers.now":     2,
+	"ServerStatusServer.name":     "Spigot 1.8.3",
+	"ServerStatusServer.protocol": 47,
+	"ServerStatus.last_online":    "1431985691",
+	"ServerStatus.last_updated":   "1431985691",
+	"ServerStatus.duration":       143439400,
+}
+
+// schemaBuilder creates schemas from Go types, adding each struct to the
+// components so it is only described once.
+type schemaBuilder struct {
+	schemas map[string]*openAPISchema
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	rawJSONType   = reflect.TypeOf(json.RawMessage{})
+	errorCodeType = reflect.TypeOf(types.ErrorCode(""))
+)
+
+var errorCodes = []string{
+	string(types.ErrorMissingAddress),
+	string(types.ErrorInvalidAddress),
+	string(types.ErrorInvalidRequest),
+	string(types.ErrorRateLimited),
+	string(types.ErrorUnavailable),
+	string(types.ErrorInvalidKey),
+	string(types.ErrorForbidden),
+}
+
+// schemaName is the component name for a struct type.
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// ref returns a schema referring to the component for v's type.
+func (b *schemaBuilder) ref(v interface{}) *openAPISchema {
+	return b.schema(reflect.TypeOf(v))
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) *openAPISchema {
+	switch {
+	case t == timeType:
+		return &openAPISchema{Type: "string", Format: "date-time"}
+	case t == rawJSONType:
+		return &openAPISchema{}
+	case t == errorCodeType:
+		return &openAPISchema{Type: "string", Enum: errorCodes}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := b.schema(t.Elem())
+		if schema.Ref != "" {
+			return &openAPISchema{AllOf: []*openAPISchema{schema}, Nullable: true}
+		}
+
+		schema.Nullable = true
+		return schema
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, ok := b.schemas[name]; !ok {
+			// Add the name first, in case the type refers to itself.
+			b.schemas[name] = nil
+			b.schemas[name] = b.object(name, t)
+		}
+
+		return &openAPISchema{Ref: "#/components/schemas/" + name}
+	case reflect.Slice, reflect.Array:
+		return &openAPISchema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return &openAPISchema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case reflect.String:
+		return &openAPISchema{Type: "string"}
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+	case reflect.Int64:
+		return &openAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &openAPISchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &openAPISchema{Type: "number"}
+	default:
+		// Interfaces may hold anything.
+		return &openAPISchema{}
+	}
+}
+
+// object describes a struct by the fields it is encoded to JSON with.
+func (b *schemaBuilder) object(name string, t reflect.Type) *openAPISchema {
+	schema := &openAPISchema{
+		Type:       "object",
+		Properties: map[string]*openAPISchema{},
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tag == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		if tag == "" {
+			tag = field.Name
+		}
+
+		property := b.schema(field.Type)
+
+		// Siblings of $ref are ignored, so it is wrapped to add details.
+		if property.Ref != "" {
+			property = &openAPISchema{AllOf: []*openAPISchema{property}}
+		}
+
+		property.Description = schemaDocs[name+"."+tag]
+		if property.Description == "" {
+			property.Description = schemaDocs[tag]
+		}
+
+		property.Example = schemaExamples[name+"."+tag]
+
+		schema.Properties[tag] = property
+	}
+
+	return schema
+}
+
+// openAPIPath converts a route path to an OpenAPI path.
+func openAPIPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+
+	return strings.Join(parts, "/")
+}
+
+func stringSchema(enum ...string) *openAPISchema {
+	return &openAPISchema{Type: "string", Enum: enum}
+}
+
+func queryParam(name, description string, schema *openAPISchema) *openAPIParameter {
+	return &openAPIParameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func pathParam(name, description string) *openAPIParameter {
+	return &openAPIParameter{Name: name, In: "path", Description: description, Required: true, Schema: stringSchema()}
+}
+
+func jsonContent(schema *openAPISchema) map[string]*openAPIMediaType {
+	return map[string]*openAPIMediaType{
+		"application/json": {Schema: schema},
+	}
+}
+
+// negotiatedContent lists every format a response may be negotiated as.
+func negotiatedContent(schema *openAPISchema) map[string]*openAPIMediaType {
+	content := map[string]*openAPIMediaType{}
+	for _, f := range outputFormats {
+		content[f.contentTypes[0]] = &openAPIMediaType{Schema: schema}
+	}
+
+	return content
+}
+
+func response(description string, content map[string]*openAPIMediaType) *openAPIResponse {
+	return &openAPIResponse{Description: description, Content: content}
+}
+
+// newOpenAPIDocument describes every public and admin route.
+func newOpenAPIDocument() *openAPIDocument {
+	b := &schemaBuilder{schemas: map[string]*openAPISchema{}}
+
+	status := b.ref(types.ServerStatus{})
+	query := b.ref(types.ServerQuery{})
+	statusV2 := b.ref(types.ServerStatusV2{})
+	queryV2 := b.ref(types.ServerQueryV2{})
+	errorV1 := b.ref(errorResponse{})
+	rateLimitedV1 := b.ref(rateLimitedResponse{})
+	errorV2 := b.ref(types.ErrorResponseV2{})
+	hook := b.ref(webhook{})
+	key := b.ref(apiKey{})
+	b.ref(webhookPayload{})
+
+	addressParams := []*openAPIParameter{
+		queryParam("ip", "the hostname or IP address of the server", stringSchema()),
+		queryParam("port", "the port of the server, 25565 if not given", &openAPISchema{Type: "integer"}),
+		queryParam("address", "the whole address, like s.nerd.nu:25565 or [2001:db8::1]:25565, instead of ip and port", stringSchema()),
+	}
+
+	formatParam := queryParam("format", "the response format, instead of using the Accept header", stringSchema(
+		"json", "msgpack", "cbor", "xml", "yaml", "text"))
+
+	fieldsParam := queryParam("fields", "only include these fields, separated by commas. nested fields are named like players.now.", stringSchema())
+	excludeParam := queryParam("exclude", "leave out these fields, separated by commas. batch responses leave out favicon unless fields or exclude is given.", stringSchema())
+
+	refreshParam := queryParam("refresh", "true to check the server now instead of using the cached result. a server may be refreshed once a minute, or every ten seconds with an API key or owner token, and each caller may only make a few refreshes.", &openAPISchema{Type: "boolean"})
+	ownerParam := &openAPIParameter{
+		Name:        ownerHeader,
+		In:          "header",
+		Description: "a token from /server/verify, which lets the server's owner refresh it more often",
+		Schema:      stringSchema(),
+	}
+
+	pathAddress := pathParam("address", "the address of the server, like s.nerd.nu or s.nerd.nu:25565")
+
+	batchParams := []*openAPIParameter{
+		queryParam("address", "an address to look up, which may be repeated", &openAPISchema{Type: "array", Items: stringSchema()}),
+	}
+
+	batchBody := &openAPIRequestBody{
+		Content: jsonContent(b.ref(batchRequest{})),
+	}
+
+	withParams := func(params []*openAPIParameter, more ...*openAPIParameter) []*openAPIParameter {
+		return append(append([]*openAPIParameter{}, params...), more...)
+	}
+
+	v1Responses := func(schema *openAPISchema) map[string]*openAPIResponse {
+		return map[string]*openAPIResponse{
+			"200": response("the result, which may be cached for up to five minutes", negotiatedContent(schema)),
+			"304": response("the result has not changed since the ETag or date given", nil),
+			"400": response("the address is missing or invalid", negotiatedContent(schema)),
+			"422": response("the address could not be resolved", negotiatedContent(errorV1)),
+			"401": response("the API key is invalid or was revoked", negotiatedContent(errorV1)),
+			"403": response("the API key may not be used for this endpoint or origin", negotiatedContent(errorV1)),
+			"429": response("too many invalid requests were made or the API key's quota was used, wait try_after seconds", negotiatedContent(rateLimitedV1)),
+			"503": response("the server could not be checked right now", negotiatedContent(errorV1)),
+		}
+	}
+
+	v2Responses := func(schema *openAPISchema) map[string]*openAPIResponse {
+		return map[string]*openAPIResponse{
+			"200": response("the result, which may be cached for up to five minutes", negotiatedContent(schema)),
+			"304": response("the result has not changed since the ETag or date given", nil),
+			"400": response("the address is missing or invalid", negotiatedContent(errorV2)),
+			"422": response("the address could not be resolved", negotiatedContent(errorV2)),
+			"401": response("the API key is invalid or was revoked", negotiatedContent(errorV2)),
+			"403": response("the API key may not be used for this endpoint or origin", negotiatedContent(errorV2)),
+			"429": response("too many invalid requests were made or the API key's quota was used", negotiatedContent(errorV2)),
+			"503": response("the server could not be checked right now", negotiatedContent(errorV2)),
+		}
+	}
+
+	statusOp := func(params []*openAPIParameter) *openAPIOperation {
+		return &openAPIOperation{
+			Summary:    "Ping a server",
+			Tags:       []string{"v1"},
+			Parameters: withParams(params, formatParam, fieldsParam, excludeParam, refreshParam, ownerParam),
+			Responses:  v1Responses(status),
+		}
+	}
+
+	queryOp := func(params []*openAPIParameter) *openAPIOperation {
+		return &openAPIOperation{
+			Summary:     "Query a server",
+			Description: "Query must be enabled on the server. It includes the players online and plugins installed.",
+			Tags:        []string{"v1"},
+			Parameters:  withParams(params, formatParam, fieldsParam, excludeParam, refreshParam, ownerParam),
+			Responses:   v1Responses(query),
+		}
+	}
+
+	imageOp := func(params []*openAPIParameter) *openAPIOperation {
+		return &openAPIOperation{
+			Summary:     "Draw an image of a server's status",
+			Description: "The image includes the server icon, or a grass block if it has none. An image with a message is drawn if the address is invalid or too many requests were made.",
+			Tags:        []string{"v1"},
+			Parameters: withParams(params,
+				queryParam("title", "text to show instead of the address", stringSchema()),
+				queryParam("theme", "dark to draw white text, for dark backgrounds", stringSchema("light", "dark")),
+			),
+			Responses: map[string]*openAPIResponse{
+				"200": response("the image", map[string]*openAPIMediaType{
+					"image/png": {Schema: &openAPISchema{Type: "string", Format: "binary"}},
+				}),
+				"304": response("the image has not changed since the ETag or date given", nil),
+			},
+		}
+	}
+
+	batchOp := func(summary string, schema *openAPISchema, responses func(*openAPISchema) map[string]*openAPIResponse, tag string, post bool) *openAPIOperation {
+		op := &openAPIOperation{
+			Summary:     summary,
+			Description: "Addresses may be given as repeated address parameters, or as a JSON body when using POST. The whole batch counts as one request towards the rate limit, weighted by how many servers were not cached.",
+			Tags:        []string{tag},
+			Parameters:  []*openAPIParameter{formatParam, fieldsParam, excludeParam},
+			Responses:   responses(schema),
+		}
+
+		if post {
+			op.RequestBody = batchBody
+		} else {
+			op.Parameters = withParams(batchParams, formatParam, fieldsParam, excludeParam)
+		}
+
+		return op
+	}
+
+	secretHeader := &openAPIParameter{
+		Name:        "Authorization",
+		In:          "header",
+		Description: "Bearer followed by the secret of the webhook",
+		Required:    true,
+		Schema:      stringSchema(),
+	}
+
+	admin := []map[string][]string{{"basic": {}}}
+	adminText := map[string]*openAPIResponse{
+		"200": response("a list of servers and when they were last updated, one per line", map[string]*openAPIMediaType{
+			"text/plain": {Schema: stringSchema()},
+		}),
+	}
+
+	graphqlOp := func(post bool) *openAPIOperation {
+		op := &openAPIOperation{
+			Summary:     "Run a GraphQL query",
+			Description: "The schema has server(address) and servers(addresses), each with status, query, history(hours) and uptime(hours). Expensive queries count as several requests towards the rate limit.",
+			Tags:        []string{"graphql"},
+			Responses: map[string]*openAPIResponse{
+				"200": response("the result of the query", jsonContent(&openAPISchema{Type: "object"})),
+				"400": response("the query was invalid or too complex", jsonContent(&openAPISchema{Type: "object"})),
+				"429": response("too many invalid requests were made", jsonContent(&openAPISchema{Type: "object"})),
+			},
+		}
+
+		if post {
+			op.RequestBody = &openAPIRequestBody{Required: true, Content: jsonContent(b.ref(graphqlRequest{}))}
+		} else {
+			op.Parameters = []*openAPIParameter{
+				queryParam("query", "a GraphQL query", stringSchema()),
+				queryParam("operationName", "which operation in the query to run", stringSchema()),
+				queryParam("variables", "values for the variables in the query, as JSON", stringSchema()),
+			}
+		}
+
+		return op
+	}
+
+	paths := map[string]map[string]*openAPIOperation{
+		"/": {
+			"get": {
+				Summary:   "The documentation for the API",
+				Responses: map[string]*openAPIResponse{"200": response("this page", map[string]*openAPIMediaType{"text/html": {Schema: stringSchema()}})},
+			},
+		},
+		"/health": {
+			"get": {
+				Summary:   "Check the API is running",
+				Responses: map[string]*openAPIResponse{"200": response("the API is running", map[string]*openAPIMediaType{"text/plain": {Schema: stringSchema()}})},
+			},
+		},
+		"/metrics": {
+			"get": {
+				Summary:     "Metrics in the Prometheus text format",
+				Description: "Requires the admin credentials if MetricsAuth is set.",
+				Security:    []map[string][]string{{}, {"basic": {}}},
+				Responses:   map[string]*openAPIResponse{"200": response("the current metrics", map[string]*openAPIMediaType{"text/plain": {Schema: stringSchema()}})},
+			},
+		},
+		"/metrics/servers": {
+			"get": {
+				Summary:     "Metrics of the monitored servers in the Prometheus text format",
+				Description: "Exports minecraft_up, players, latency, version and plugin counts for every server in MonitoredServers, from the cache.",
+				Responses:   map[string]*openAPIResponse{"200": response("the servers' metrics", map[string]*openAPIMediaType{"text/plain": {Schema: stringSchema()}})},
+			},
+		},
+		"/probe": {
+			"get": {
+				Summary:     "Get the status and query of a server as Prometheus metrics",
+				Description: "Works like a blackbox exporter probe, so Prometheus can scrape any server by setting target. Results are cached like other lookups, and servers are only pinged and queried when they are not cached.",
+				Parameters: []*openAPIParameter{
+					{Name: "target", In: "query", Description: "the address of the server, with an optional port", Required: true, Schema: stringSchema()},
+				},
+				Responses: map[string]*openAPIResponse{
+					"200": response("the server's metrics", map[string]*openAPIMediaType{"text/plain": {Schema: stringSchema()}}),
+					"400": response("the target is missing or invalid", map[string]*openAPIMediaType{"text/plain": {Schema: stringSchema()}}),
+					"401": response("MetricsAuth is set and the admin credentials were not given", nil),
+					"429": response("too many failed probes", jsonContent(rateLimitedV1)),
+				},
+			},
+		},
+		"/stats": {
+			"get": {
+				Summary: "The number of requests the API has received",
+				Responses: map[string]*openAPIResponse{
+					"200": response("the number of requests", jsonContent(&openAPISchema{
+						Type: "object",
+						Properties: map[string]*openAPISchema{
+							"stats": {Type: "integer", Description: "the total number of requests"},
+							"time":  {Type: "integer", Format: "int64", Description: "the current time, in unix nanoseconds"},
+						},
+					})),
+				},
+			},
+		},
+		"/openapi.json": {
+			"get": {
+				Summary:   "This OpenAPI document",
+				Responses: map[string]*openAPIResponse{"200": response("the document", jsonContent(&openAPISchema{Type: "object"}))},
+			},
+		},
+
+		"/server/status":               {"get": statusOp(addressParams)},
+		"/server/status/{address}":     {"get": statusOp([]*openAPIParameter{pathAddress})},
+		"/minecraft/1.3/server/status": {"get": deprecated(statusOp(addressParams))},
+		"/server/status/batch": {
+			"get":  batchOp("Ping many servers", b.ref(types.ServerStatusBatch{}), v1Responses, "v1", false),
+			"post": batchOp("Ping many servers", b.ref(types.ServerStatusBatch{}), v1Responses, "v1", true),
+		},
+		"/server/query":               {"get": queryOp(addressParams)},
+		"/server/query/{address}":     {"get": queryOp([]*openAPIParameter{pathAddress})},
+		"/minecraft/1.3/server/query": {"get": deprecated(queryOp(addressParams))},
+		"/server/image":               {"get": imageOp(addressParams)},
+		"/server/image/{address}": {"get": imageOp([]*openAPIParameter{
+			pathParam("address", "the address of the server, which may end with .png, like s.nerd.nu.png"),
+		})},
+
+		"/server/icon/{address}": {
+			"get": {
+				Summary:     "Get a server's icon",
+				Description: "The icon is decoded from the favicon of the server's status, or is a grass block if it has none.",
+				Tags:        []string{"v1"},
+				Parameters: []*openAPIParameter{
+					pathParam("address", "the address of the server, which may end with .png, like s.nerd.nu.png"),
+					queryParam("size", "the width and height to scale the icon to, between 16 and 256, using nearest neighbour scaling", &openAPISchema{Type: "integer", Example: 128}),
+				},
+				Responses: map[string]*openAPIResponse{
+					"200": response("the icon", map[string]*openAPIMediaType{
+						"image/png": {Schema: &openAPISchema{Type: "string", Format: "binary"}},
+					}),
+					"304": response("the icon has not changed since the ETag given", nil),
+					"400": response("the address or size is invalid", negotiatedContent(errorV1)),
+					"422": response("the address could not be resolved", negotiatedContent(errorV1)),
+					"429": response("too many invalid requests were made, wait try_after seconds", negotiatedContent(rateLimitedV1)),
+				},
+			},
+		},
+
+		"/server/refresh": {
+			"post": {
+				Summary:     "Refresh a server now",
+				Description: "Checks the server immediately instead of waiting for the next scheduled refresh. A server may be refreshed once a minute, or every ten seconds with an API key or owner token, and each caller may only make a few refreshes.",
+				Tags:        []string{"v1"},
+				Parameters: withParams(addressParams,
+					queryParam("kind", "status to ping the server, or query to query it", stringSchema(eventStatus, eventQuery)),
+					ownerParam,
+					formatParam,
+				),
+				Responses: map[string]*openAPIResponse{
+					"200": response("the new result, which is a ServerQuery when kind is query", negotiatedContent(status)),
+					"400": response("the address or kind is invalid", negotiatedContent(errorV1)),
+					"422": response("the address could not be resolved", negotiatedContent(errorV1)),
+					"429": response("the server was refreshed too recently or too many refreshes were made, wait try_after seconds", negotiatedContent(rateLimitedV1)),
+					"503": response("the server could not be checked right now", negotiatedContent(errorV1)),
+				},
+			},
+		},
+		"/server/verify": {
+			"post": {
+				Summary:     "Verify ownership of a server",
+				Description: "The first request gives a code to add to the server's MOTD and a nonce. Once the code has been added, make the same request again with the nonce to get a token, which lets the owner refresh the server more often when sent in the X-Owner-Token header.",
+				Tags:        []string{"v1"},
+				Parameters: withParams(addressParams,
+					queryParam("nonce", "the nonce given with the code, to check the MOTD for it", &openAPISchema{Type: "string"}),
+					formatParam,
+				),
+				Responses: map[string]*openAPIResponse{
+					"200": response("the code was found, and a token was issued", negotiatedContent(b.ref(ownerVerification{}))),
+					"202": response("the code to add to the MOTD", negotiatedContent(b.ref(ownerVerification{}))),
+					"400": response("the address is invalid, or the nonce is unknown or has expired", negotiatedContent(errorV1)),
+					"429": response("the server was refreshed too recently or too many refreshes were made, wait try_after seconds", negotiatedContent(rateLimitedV1)),
+				},
+			},
+		},
+
+		"/server/events": {
+			"get": {
+				Summary:     "Stream status changes as Server-Sent Events",
+				Description: "The current status of each server is sent first as a status event, or an error event if it could not be checked. A status event follows whenever a refresh changes a server.",
+				Tags:        []string{"streaming"},
+				Parameters:  batchParams,
+				Responses: map[string]*openAPIResponse{
+					"200": response("a stream of events", map[string]*openAPIMediaType{
+						"text/event-stream": {Schema: b.ref(serverEvent{})},
+					}),
+					"400": response("the addresses are missing or invalid", jsonContent(errorV1)),
+					"429": response("too many invalid requests were made", jsonContent(rateLimitedV1)),
+				},
+			},
+		},
+		"/ws": {
+			"get": {
+				Summary:     "Follow servers over a WebSocket",
+				Description: `Send {"type": "subscribe", "address": "..."} to follow a server, "unsubscribe" to stop, or "refresh" with a kind of status or query to check it now. Status and query messages include only the fields which changed since the last one.`,
+				Tags:        []string{"streaming"},
+				Responses: map[string]*openAPIResponse{
+					"101": response("the connection was upgraded to a WebSocket", nil),
+					"429": response("too many connections from this IP address", jsonContent(errorV1)),
+				},
+			},
+		},
+
+		"/v2/server/status":           {"get": {Summary: "Ping a server", Tags: []string{"v2"}, Parameters: withParams(addressParams, formatParam, fieldsParam, excludeParam, refreshParam, ownerParam), Responses: v2Responses(statusV2)}},
+		"/v2/server/status/{address}": {"get": {Summary: "Ping a server", Tags: []string{"v2"}, Parameters: []*openAPIParameter{pathAddress, formatParam, fieldsParam, excludeParam, refreshParam, ownerParam}, Responses: v2Responses(statusV2)}},
+		"/v2/server/query":            {"get": {Summary: "Query a server", Tags: []string{"v2"}, Parameters: withParams(addressParams, formatParam, fieldsParam, excludeParam, refreshParam, ownerParam), Responses: v2Responses(queryV2)}},
+		"/v2/server/query/{address}":  {"get": {Summary: "Query a server", Tags: []string{"v2"}, Parameters: []*openAPIParameter{pathAddress, formatParam, fieldsParam, excludeParam, refreshParam, ownerParam}, Responses: v2Responses(queryV2)}},
+		"/v2/server/status/batch": {
+			"get":  batchOp("Ping many servers", b.ref(types.ServerStatusBatchV2{}), v2Responses, "v2", false),
+			"post": batchOp("Ping many servers", b.ref(types.ServerStatusBatchV2{}), v2Responses, "v2", true),
+		},
+
+		"/graphql": {
+			"get":  graphqlOp(false),
+			"post": graphqlOp(true),
+		},
+
+		"/webhooks": {
+			"post": {
+				Summary:     "Create a webhook",
+				Description: "Deliveries are posted as JSON with X-Mcapi-Event, X-Mcapi-Delivery and X-Mcapi-Signature headers. The signature is sha256= followed by the hex HMAC-SHA256 of the body, keyed with the secret. Failed deliveries are retried, and the webhook is disabled after ten failures in a row. Each server and caller may have ten webhooks, and webhooks are removed once their server has been unreachable for a week.",
+				Tags:        []string{"webhooks"},
+				RequestBody: &openAPIRequestBody{Required: true, Content: jsonContent(b.ref(webhookRequest{}))},
+				Responses: map[string]*openAPIResponse{
+					"201": response("the webhook, including its secret", negotiatedContent(hook)),
+					"400": response("the webhook is invalid", negotiatedContent(errorV1)),
+					"409": response("the server or caller has too many webhooks", negotiatedContent(errorV1)),
+					"429": response("too many invalid requests were made", negotiatedContent(rateLimitedV1)),
+					"503": response("the limit of webhooks was reached", negotiatedContent(errorV1)),
+				},
+			},
+		},
+		"/webhooks/{id}": {
+			"get": {
+				Summary:    "Get a webhook and its recent deliveries",
+				Tags:       []string{"webhooks"},
+				Parameters: []*openAPIParameter{pathParam("id", "the ID of the webhook"), secretHeader},
+				Responses: map[string]*openAPIResponse{
+					"200": response("the webhook", negotiatedContent(hook)),
+					"404": response("the webhook does not exist or the secret is wrong", negotiatedContent(errorV1)),
+				},
+			},
+			"delete": {
+				Summary:    "Delete a webhook",
+				Tags:       []string{"webhooks"},
+				Parameters: []*openAPIParameter{pathParam("id", "the ID of the webhook"), secretHeader},
+				Responses: map[string]*openAPIResponse{
+					"204": response("the webhook was deleted", nil),
+					"404": response("the webhook does not exist or the secret is wrong", negotiatedContent(errorV1)),
+				},
+			},
+		},
+
+		"/interactions/discord": {
+			"post": {
+				Summary:     "Handle Discord interactions",
+				Description: "Requests must be signed by Discord with the configured public key. Handles the /mcstatus command.",
+				Tags:        []string{"chat"},
+				RequestBody: &openAPIRequestBody{Required: true, Content: jsonContent(&openAPISchema{Type: "object"})},
+				Responses: map[string]*openAPIResponse{
+					"200": response("the reply to the interaction", map[string]*openAPIMediaType{
+						"application/json":    {Schema: &openAPISchema{Type: "object"}},
+						"multipart/form-data": {Schema: &openAPISchema{Type: "object"}},
+					}),
+					"401": response("the signature is invalid", nil),
+				},
+			},
+		},
+		"/interactions/slack": {
+			"post": {
+				Summary:     "Handle Slack slash commands",
+				Description: "Requests must be signed with the configured Slack signing secret. Handles the /mcstatus command.",
+				Tags:        []string{"chat"},
+				RequestBody: &openAPIRequestBody{Required: true, Content: map[string]*openAPIMediaType{
+					"application/x-www-form-urlencoded": {Schema: &openAPISchema{Type: "object"}},
+				}},
+				Responses: map[string]*openAPIResponse{
+					"200": response("the reply to the command", jsonContent(&openAPISchema{Type: "object"})),
+					"401": response("the signature is invalid", nil),
+				},
+			},
+		},
+
+		"/admin/ping":  {"get": {Summary: "List cached statuses", Tags: []string{"admin"}, Security: admin, Responses: adminText}},
+		"/admin/query": {"get": {Summary: "List cached queries", Tags: []string{"admin"}, Security: admin, Responses: adminText}},
+		"/admin/jobs": {"get": {
+			Summary: "Show the depth of the job queues", Tags: []string{"admin"}, Security: admin,
+			Responses: map[string]*openAPIResponse{"200": response("the job queues", jsonContent(&openAPISchema{Type: "object"}))},
+		}},
+		"/admin/lanes": {"get": {
+			Summary: "Show the refresh lanes", Tags: []string{"admin"}, Security: admin,
+			Responses: map[string]*openAPIResponse{"200": response("each lane", jsonContent(&openAPISchema{
+				Type:       "object",
+				Properties: map[string]*openAPISchema{"lanes": {Type: "array", Items: b.ref(laneStats{})}},
+			}))},
+		}},
+		"/admin/cache": {"get": {
+			Summary: "Show how full the caches are", Tags: []string{"admin"}, Security: admin,
+			Responses: map[string]*openAPIResponse{"200": response("each cache", jsonContent(&openAPISchema{
+				Type: "object",
+				Properties: map[string]*openAPISchema{
+					"status": b.ref(cacheStats{}),
+					"query":  b.ref(cacheStats{}),
+				},
+			}))},
+		}},
+		"/admin/webhooks": {"get": {
+			Summary: "List every webhook", Tags: []string{"admin"}, Security: admin,
+			Responses: map[string]*openAPIResponse{"200": response("every webhook, without secrets or deliveries", jsonContent(&openAPISchema{
+				Type:       "object",
+				Properties: map[string]*openAPISchema{"webhooks": {Type: "array", Items: hook}},
+			}))},
+		}},
+		"/admin/keys": {
+			"get": {
+				Summary: "List every API key", Tags: []string{"admin"}, Security: admin,
+				Responses: map[string]*openAPIResponse{"200": response("every key, without usage", jsonContent(&openAPISchema{
+					Type:       "object",
+					Properties: map[string]*openAPISchema{"keys": {Type: "array", Items: key}},
+				}))},
+			},
+			"post": {
+				Summary:     "Create an API key",
+				Description: "Limits which are not given are taken from the tier, which is free, standard or unlimited.",
+				Tags:        []string{"admin"}, Security: admin,
+				RequestBody: &openAPIRequestBody{Required: true, Content: jsonContent(b.ref(apiKeyRequest{}))},
+				Responses: map[string]*openAPIResponse{
+					"201": response("the key, which is the only time it is shown", jsonContent(key)),
+					"400": response("the key is invalid", jsonContent(errorV1)),
+				},
+			},
+		},
+		"/admin/keys/{id}": {
+			"get": {
+				Summary: "Get an API key and its daily usage", Tags: []string{"admin"}, Security: admin,
+				Parameters: []*openAPIParameter{pathParam("id", "the ID of the key")},
+				Responses: map[string]*openAPIResponse{
+					"200": response("the key", jsonContent(key)),
+					"404": response("the key does not exist", jsonContent(errorV1)),
+				},
+			},
+			"delete": {
+				Summary: "Revoke an API key", Tags: []string{"admin"}, Security: admin,
+				Parameters: []*openAPIParameter{pathParam("id", "the ID of the key")},
+				Responses: map[string]*openAPIResponse{
+					"204": response("the key was revoked", nil),
+					"404": response("the key does not exist", jsonContent(errorV1)),
+				},
+			},
+		},
+		"/admin/refresh": {"post": {
+			Summary: "Refresh a server now", Tags: []string{"admin"}, Security: admin,
+			Parameters: addressParams[:2],
+			Responses:  map[string]*openAPIResponse{"200": response("the refresh was queued", map[string]*openAPIMediaType{"text/plain": {Schema: stringSchema()}})},
+		}},
+		"/admin/clear": {"post": {
+			Summary: "Clear the caches", Tags: []string{"admin"}, Security: admin,
+			Responses: map[string]*openAPIResponse{"200": response("the caches were cleared", map[string]*openAPIMediaType{"text/plain": {Schema: stringSchema()}})},
+		}},
+	}
+
+	return &openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title:       "Minecraft API",
+			Description: "A simple way to get the status of or query a Minecraft server.",
+			Version:     "2.0.0",
+		},
+		Paths: paths,
+		Components: openAPIComponents{
+			Schemas: b.schemas,
+			SecuritySchemes: map[string]*openAPISecurityScheme{
+				"basic":       {Type: "http", Scheme: "basic", Description: "the admin key, with the username mcapi"},
+				"apiKey":      {Type: "apiKey", Name: apiKeyHeader, In: "header", Description: "an issued API key, which is limited by its own quotas instead of by IP address"},
+				"apiKeyQuery": {Type: "apiKey", Name: apiKeyParam, In: "query", Description: "an issued API key, sent as a parameter"},
+			},
+		},
+		// API keys are optional, requests without one are limited by IP address.
+		Security: []map[string][]string{{}, {"apiKey": {}}, {"apiKeyQuery": {}}},
+	}
+}
+
+func deprecated(op *openAPIOperation) *openAPIOperation {
+	op.Deprecated = true
+	op.Description = "An older path for the same request, kept for existing users."
+	return op
+}
+
+var openAPISpec = newOpenAPIDocument()
+
+func respondOpenAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, openAPISpec)
+}
+
+// apiField is a field of a schema, flattened for showing in a table.
+type apiField struct {
+	Name        string
+	Type        string
+	Description string
+	Example     interface{}
+}
+
+// schemaFields flattens the fields of a component, so nested fields are
+// listed with their full name like players.max.
+func (d *openAPIDocument) schemaFields(name string) []apiField {
+	var fields []apiField
+
+	var walk func(prefix string, schema *openAPISchema)
+	walk = func(prefix string, schema *openAPISchema) {
+		names := make([]string, 0, len(schema.Properties))
+		for name := range schema.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			property := schema.Properties[name]
+
+			if target := d.resolve(property); target != nil && target.Type == "object" && target.Properties != nil {
+				walk(prefix+name+".", target)
+				continue
+			}
+
+			fields = append(fields, apiField{
+				Name:        prefix + name,
+				Type:        d.resolve(property).Type,
+				Description: property.Description,
+				Example:     property.Example,
+			})
+		}
+	}
+
+	if schema := d.Components.Schemas[name]; schema != nil {
+		walk("", schema)
+	}
+
+	return fields
+}
+
+// resolve follows references to the schema they refer to.
+func (d *openAPIDocument) resolve(schema *openAPISchema) *openAPISchema {
+	for {
+		if len(schema.AllOf) == 1 {
+			schema = schema.AllOf[0]
+			continue
+		}
+
+		if strings.HasPrefix(schema.Ref, "#/components/schemas/") {
+			schema = d.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+			continue
+		}
+
+		return schema
+	}
+}
+
+// apiRoute is an operation, for listing in the documentation.
+type apiRoute struct {
+	Method    string
+	Path      string
+	Operation *openAPIOperation
+}
+
+// routes lists every operation except admin ones, sorted by path.
+func (d *openAPIDocument) routes() []apiRoute {
+	var routes []apiRoute
+
+	for path, item := range d.Paths {
+		if strings.HasPrefix(path, "/admin/") {
+			continue
+		}
+
+		for method, op := range item {
+			routes = append(routes, apiRoute{
+				Method:    strings.ToUpper(method),
+				Path:      path,
+				Operation: op,
+			})
+		}
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+
+		return routes[i].Method < routes[j].Method
+	})
+
+	return routes
+}
+
+// ResponseCodes lists the status codes an operation may respond with.
+func (op *openAPIOperation) ResponseCodes() []string {
+	codes := make([]string, 0, len(op.Responses))
+	for code := range op.Responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	return codes
+}
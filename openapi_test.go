@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func openAPIRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	requestCounter = &memoryCounter{}
+
+	return newRouter(&Config{
+		StaticFiles:  "./scripts",
+		TemplateFile: "templates/index.html",
+	})
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	spec := newOpenAPIDocument()
+
+	for _, route := range openAPIRouter().Routes() {
+		if route.Method == http.MethodHead || strings.HasPrefix(route.Path, "/scripts/") {
+			continue
+		}
+
+		item, ok := spec.Paths[openAPIPath(route.Path)]
+		if !ok {
+			t.Errorf("%s is not in the OpenAPI document", route.Path)
+			continue
+		}
+
+		if _, ok := item[strings.ToLower(route.Method)]; !ok {
+			t.Errorf("%s %s is not in the OpenAPI document", route.Method, route.Path)
+		}
+	}
+}
+
+func TestOpenAPIDescribesFields(t *testing.T) {
+	spec := newOpenAPIDocument()
+
+	for _, name := range []string{"ServerStatus", "ServerQuery", "ServerStatusV2", "ServerQueryV2", "RateLimitedResponse"} {
+		if spec.Components.Schemas[name] == nil {
+			t.Errorf("%s is not in the OpenAPI document", name)
+		}
+	}
+
+	for name, schema := range spec.Components.Schemas {
+		for field, property := range schema.Properties {
+			if property.Description == "" {
+				t.Errorf("%s.%s has no description", name, field)
+			}
+		}
+	}
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	router := openAPIRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"openapi":"3.0.3"`) {
+		t.Fatalf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+
+	for _, want := range []string{"players.max", "GET /server/image/{address}", "theme", "try_after"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("landing page is missing %q", want)
+		}
+	}
+}
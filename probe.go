@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultProbeTimeout is used when no timeout has been configured for a probe.
+const defaultProbeTimeout = 5 * time.Second
+
+// statusTimeout and queryTimeout limit how long a single probe may take,
+// including DNS resolution, connecting and reading the response.
+var statusTimeout = defaultProbeTimeout
+var queryTimeout = defaultProbeTimeout
+
+const (
+	// slpProtocolVersion is the protocol version sent in the handshake.
+	// Servers respond to status requests regardless of the version sent.
+	slpProtocolVersion = 47
+	// slpMaxResponse limits how much data is read from a status response.
+	slpMaxResponse = 2 << 20
+	// queryMaxResponse is the largest UDP packet a query response may use.
+	queryMaxResponse = 65535
+)
+
+// pong is the JSON document returned by a server list ping.
+type pong struct {
+	Version struct {
+		Name     string `json:"name"`
+		Protocol int    `json:"protocol"`
+	} `json:"version"`
+	Players struct {
+		Max    int `json:"max"`
+		Online int `json:"online"`
+	} `json:"players"`
+	Description interface{} `json:"description"`
+	FavIcon     string      `json:"favicon"`
+}
+
+// queryStat is the result of a full stat query.
+type queryStat struct {
+	MOTD       string
+	GameType   string
+	GameID     string
+	Version    string
+	ServerMod  string
+	Plugins    []string
+	Map        string
+	NumPlayers int
+	MaxPlayers int
+	Players    []string
+}
+
+// dialServer resolves and connects to a server within the lifetime of ctx.
+// The returned function must be called once the connection is no longer
+// needed; until then, cancelling ctx interrupts any pending reads or writes.
+func dialServer(ctx context.Context, network, serverAddr string) (net.Conn, func(), error) {
+	host, port, err := net.SplitHostPort(serverAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var addrs []string
+
+	err = traceStep(ctx, "dns", func() (err error) {
+		addrs, err = net.DefaultResolver.LookupHost(ctx, host)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var conn net.Conn
+
+	err = traceStep(ctx, "connect", func() (err error) {
+		conn, err = dialAddrs(ctx, network, addrs, port)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+
+	return conn, func() {
+		stop()
+		conn.Close()
+	}, nil
+}
+
+// dialAddrs connects to each resolved address in turn until one succeeds.
+// Each attempt gets an equal share of the time remaining, so one address
+// which doesn't respond can't use it all up.
+func dialAddrs(ctx context.Context, network string, addrs []string, port string) (net.Conn, error) {
+	var dialer net.Dialer
+	var err error
+
+	for i, addr := range addrs {
+		dialCtx, cancel := ctx, context.CancelFunc(func() {})
+		if deadline, ok := ctx.Deadline(); ok {
+			dialCtx, cancel = context.WithTimeout(ctx, time.Until(deadline)/time.Duration(len(addrs)-i))
+		}
+
+		var conn net.Conn
+		conn, err = dialer.DialContext(dialCtx, network, net.JoinHostPort(addr, port))
+		cancel()
+
+		if err == nil {
+			return conn, nil
+		}
+	}
+
+	return nil, err
+}
+
+// probeError prefers the context's error when a probe was interrupted,
+// so callers can tell a cancelled probe apart from an unreachable server.
+func probeError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	// The connection's deadline may pass just before the context's.
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+
+	return err
+}
+
+// pingServer performs a server list ping.
+func pingServer(ctx context.Context, serverAddr string) (*pong, error) {
+	host, portString, err := net.SplitHostPort(serverAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, errors.New("unknown port")
+	}
+
+	conn, done, err := dialServer(ctx, "tcp", serverAddr)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	handshake := &bytes.Buffer{}
+	writeVarInt(handshake, 0x00)
+	writeVarInt(handshake, slpProtocolVersion)
+	writeVarInt(handshake, len(host))
+	handshake.WriteString(host)
+	binary.Write(handshake, binary.BigEndian, uint16(port))
+	writeVarInt(handshake, 1)
+
+	packet := &bytes.Buffer{}
+	writeVarInt(packet, handshake.Len())
+	packet.Write(handshake.Bytes())
+	// Status request, a packet with no fields.
+	writeVarInt(packet, 1)
+	writeVarInt(packet, 0x00)
+
+	err = traceStep(ctx, "handshake", func() error {
+		if _, err := conn.Write(packet.Bytes()); err != nil {
+			return probeError(ctx, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+
+	err = traceStep(ctx, "read response", func() (err error) {
+		data, err = readStatusResponse(ctx, conn)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var p pong
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// readStatusResponse reads the JSON document from a status response packet.
+func readStatusResponse(ctx context.Context, conn net.Conn) ([]byte, error) {
+	r := bufio.NewReader(conn)
+
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, probeError(ctx, err)
+	}
+	if length > slpMaxResponse {
+		return nil, errors.New("status response too large")
+	}
+
+	body := io.LimitReader(r, int64(length))
+	br := bufio.NewReader(body)
+
+	if id, err := binary.ReadUvarint(br); err != nil {
+		return nil, probeError(ctx, err)
+	} else if id != 0x00 {
+		return nil, errors.New("unexpected status response packet")
+	}
+
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, probeError(ctx, err)
+	}
+	if size > length {
+		return nil, errors.New("status response too large")
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return nil, probeError(ctx, err)
+	}
+
+	return data, nil
+}
+
+// queryServer performs a full stat query over UDP.
+func queryServer(ctx context.Context, serverAddr string) (*queryStat, error) {
+	conn, done, err := dialServer(ctx, "udp", serverAddr)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	sessionID := rand.Uint32() & 0x0F0F0F0F
+	buf := make([]byte, queryMaxResponse)
+
+	var token int64
+
+	err = traceStep(ctx, "handshake", func() (err error) {
+		token, err = queryChallenge(ctx, conn, sessionID, buf)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	request := []byte{0xFE, 0xFD, 0x00}
+	request = binary.BigEndian.AppendUint32(request, sessionID)
+	request = binary.BigEndian.AppendUint32(request, uint32(int32(token)))
+	request = append(request, 0x00, 0x00, 0x00, 0x00)
+
+	var n int
+
+	err = traceStep(ctx, "read response", func() (err error) {
+		if _, err = conn.Write(request); err != nil {
+			return probeError(ctx, err)
+		}
+
+		if n, err = conn.Read(buf); err != nil {
+			return probeError(ctx, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return parseFullStat(buf[:n])
+}
+
+// queryChallenge performs the query handshake, returning the challenge
+// token to send with the stat request.
+func queryChallenge(ctx context.Context, conn net.Conn, sessionID uint32, buf []byte) (int64, error) {
+	request := []byte{0xFE, 0xFD, 0x09}
+	request = binary.BigEndian.AppendUint32(request, sessionID)
+
+	if _, err := conn.Write(request); err != nil {
+		return 0, probeError(ctx, err)
+	}
+
+	n, err := conn.Read(buf)
+	if err != nil {
+		return 0, probeError(ctx, err)
+	}
+	if n < 6 || buf[0] != 0x09 {
+		return 0, errors.New("unexpected query handshake response")
+	}
+
+	token, err := strconv.ParseInt(string(bytes.TrimRight(buf[5:n], "\x00")), 10, 32)
+	if err != nil {
+		return 0, errors.New("invalid query challenge token")
+	}
+
+	return token, nil
+}
+
+// parseFullStat decodes a full stat response. It consists of a header, a
+// list of null terminated key and value pairs, and a list of player names.
+func parseFullStat(data []byte) (*queryStat, error) {
+	// Type, session ID and the constant "splitnum" padding.
+	const headerLength = 1 + 4 + 11
+
+	if len(data) < headerLength || data[0] != 0x00 {
+		return nil, errors.New("unexpected query response")
+	}
+
+	// Every field is null terminated, so anything after the last null is
+	// a field which was cut off.
+	fields := bytes.Split(data[headerLength:], []byte{0x00})
+	fields = fields[:len(fields)-1]
+
+	values := map[string]string{}
+
+	i := 0
+	for ; i+1 < len(fields) && len(fields[i]) > 0; i += 2 {
+		values[string(fields[i])] = string(fields[i+1])
+	}
+
+	stat := &queryStat{
+		MOTD:     values["hostname"],
+		GameType: values["gametype"],
+		GameID:   values["game_id"],
+		Version:  values["version"],
+		Map:      values["map"],
+	}
+
+	stat.NumPlayers, _ = strconv.Atoi(values["numplayers"])
+	stat.MaxPlayers, _ = strconv.Atoi(values["maxplayers"])
+
+	plugins := values["plugins"]
+	if idx := strings.Index(plugins, ":"); idx != -1 {
+		stat.ServerMod = strings.TrimSpace(plugins[:idx])
+		for _, plugin := range strings.Split(plugins[idx+1:], ";") {
+			if plugin = strings.TrimSpace(plugin); plugin != "" {
+				stat.Plugins = append(stat.Plugins, plugin)
+			}
+		}
+	} else {
+		stat.ServerMod = strings.TrimSpace(plugins)
+	}
+
+	// Skip the empty key ending the values and the "\x01player_" padding.
+	if i+3 < len(fields) {
+		for _, name := range fields[i+3:] {
+			if len(name) == 0 {
+				break
+			}
+
+			stat.Players = append(stat.Players, string(name))
+		}
+	}
+
+	return stat, nil
+}
+
+func writeVarInt(w *bytes.Buffer, value int) {
+	w.Write(binary.AppendUvarint(nil, uint64(uint32(value))))
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// statusPacket frames a status response the way a server sends it.
+func statusPacket(body string) []byte {
+	payload := &bytes.Buffer{}
+	writeVarInt(payload, 0x00)
+	writeVarInt(payload, len(body))
+	payload.WriteString(body)
+
+	packet := &bytes.Buffer{}
+	writeVarInt(packet, payload.Len())
+	packet.Write(payload.Bytes())
+
+	return packet.Bytes()
+}
+
+// capturedStatus is a status response from a vanilla 1.20.4 server.
+const capturedStatus = `{"version":{"name":"1.20.4","protocol":765},"enforcesSecureChat":true,` +
+	`"description":{"text":"A Minecraft Server"},"players":{"max":20,"online":2,` +
+	`"sample":[{"id":"069a79f4-44e9-4726-a5be-fca90e38aaf5","name":"Notch"}]},` +
+	`"favicon":"data:image/png;base64,iVBORw0KGgo="}`
+
+// fakeStatusServer accepts one connection, reads the handshake and status
+// request and writes response.
+func fakeStatusServer(t *testing.T, response []byte) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.Read(make([]byte, 512))
+		conn.Write(response)
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestPingServer(t *testing.T) {
+	truncated := statusPacket(capturedStatus)
+
+	tooLarge := binary.AppendUvarint(nil, slpMaxResponse+1)
+
+	wrongPacket := &bytes.Buffer{}
+	writeVarInt(wrongPacket, 2)
+	writeVarInt(wrongPacket, 0x01)
+	writeVarInt(wrongPacket, 0)
+
+	tests := []struct {
+		name     string
+		response []byte
+		ok       bool
+	}{
+		{"captured", statusPacket(capturedStatus), true},
+		{"truncated", truncated[:len(truncated)-10], false},
+		{"empty", nil, false},
+		{"too large", tooLarge, false},
+		{"wrong packet", wrongPacket.Bytes(), false},
+		{"malformed json", statusPacket(`{"version":`), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			p, err := pingServer(ctx, fakeStatusServer(t, test.response))
+			if !test.ok {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", p)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if p.Version.Name != "1.20.4" || p.Version.Protocol != 765 || p.Players.Online != 2 || p.Players.Max != 20 {
+				t.Errorf("unexpected status %+v", p)
+			}
+
+			if p.FavIcon != "data:image/png;base64,iVBORw0KGgo=" {
+				t.Errorf("unexpected favicon %q", p.FavIcon)
+			}
+		})
+	}
+}
+
+// capturedFullStat is a full stat response from a Paper server with two
+// players online.
+var capturedFullStat = []byte("\x00\x00\x00\x00\x01splitnum\x00\x80\x00" +
+	"hostname\x00A Minecraft Server\x00gametype\x00SMP\x00game_id\x00MINECRAFT\x00" +
+	"version\x001.20.4\x00plugins\x00Paper on 1.20.4: WorldEdit 7.2.15; Essentials 2.20\x00" +
+	"map\x00world\x00numplayers\x002\x00maxplayers\x0020\x00hostport\x0025565\x00hostip\x00127.0.0.1\x00\x00" +
+	"\x01player_\x00\x00Notch\x00jeb_\x00\x00")
+
+func TestParseFullStat(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want *queryStat
+	}{
+		{"captured", capturedFullStat, &queryStat{
+			MOTD:       "A Minecraft Server",
+			GameType:   "SMP",
+			GameID:     "MINECRAFT",
+			Version:    "1.20.4",
+			ServerMod:  "Paper on 1.20.4",
+			Plugins:    []string{"WorldEdit 7.2.15", "Essentials 2.20"},
+			Map:        "world",
+			NumPlayers: 2,
+			MaxPlayers: 20,
+			Players:    []string{"Notch", "jeb_"},
+		}},
+		{"vanilla", []byte("\x00\x00\x00\x00\x01splitnum\x00\x80\x00" +
+			"hostname\x00Vanilla\x00plugins\x00\x00numplayers\x000\x00maxplayers\x0010\x00\x00" +
+			"\x01player_\x00\x00\x00"), &queryStat{
+			MOTD:       "Vanilla",
+			MaxPlayers: 10,
+		}},
+		{"truncated values", capturedFullStat[:60], &queryStat{
+			MOTD:     "A Minecraft Server",
+			GameType: "SMP",
+		}},
+		{"truncated players", capturedFullStat[:len(capturedFullStat)-5], &queryStat{
+			MOTD:       "A Minecraft Server",
+			GameType:   "SMP",
+			GameID:     "MINECRAFT",
+			Version:    "1.20.4",
+			ServerMod:  "Paper on 1.20.4",
+			Plugins:    []string{"WorldEdit 7.2.15", "Essentials 2.20"},
+			Map:        "world",
+			NumPlayers: 2,
+			MaxPlayers: 20,
+			Players:    []string{"Notch"},
+		}},
+		{"malformed numbers", []byte("\x00\x00\x00\x00\x01splitnum\x00\x80\x00numplayers\x00lots\x00\x00"), &queryStat{}},
+		{"short header", capturedFullStat[:10], nil},
+		{"wrong type", append([]byte{0x09}, capturedFullStat[1:]...), nil},
+		{"empty", nil, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stat, err := parseFullStat(test.data)
+			if test.want == nil {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", stat)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(stat, test.want) {
+				t.Errorf("expected %+v, got %+v", test.want, stat)
+			}
+		})
+	}
+}
+
+// fakeQueryServer answers a query handshake with challenge, and a stat
+// request with response.
+func fakeQueryServer(t *testing.T, challenge string, response []byte) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			if n < 7 {
+				continue
+			}
+
+			switch buf[2] {
+			case 0x09:
+				reply := append([]byte{0x09}, buf[3:7]...)
+				conn.WriteTo(append(reply, challenge+"\x00"...), addr)
+			case 0x00:
+				conn.WriteTo(response, addr)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestQueryServer(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		response  []byte
+		ok        bool
+	}{
+		{"captured", "9513307", capturedFullStat, true},
+		{"invalid challenge", "not a number", capturedFullStat, false},
+		{"truncated", "9513307", capturedFullStat[:10], false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			stat, err := queryServer(ctx, fakeQueryServer(t, test.challenge, test.response))
+			if !test.ok {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", stat)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if stat.MOTD != "A Minecraft Server" || len(stat.Players) != 2 {
+				t.Errorf("unexpected stat %+v", stat)
+			}
+		})
+	}
+}
+
+func TestQueryServerTimeout(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := queryServer(ctx, conn.LocalAddr().String()); err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline to be reported, got %v", err)
+	}
+}
+
+func TestPingServerCancelled(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// Accept the connection but never respond.
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			conn.Read(make([]byte, 512))
+			time.Sleep(time.Second)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	started := time.Now()
+
+	if _, err := pingServer(ctx, listener.Addr().String()); err != context.Canceled {
+		t.Errorf("expected the cancellation to be reported, got %v", err)
+	}
+
+	if took := time.Since(started); took > 500*time.Millisecond {
+		t.Errorf("expected the ping to stop once cancelled, took %s", took)
+	}
+}
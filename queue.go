@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gocraft/work"
+	"github.com/gomodule/redigo/redis"
+)
+
+// jobQueue holds refresh jobs until a lane's workers are free to run them.
+type jobQueue interface {
+	// enqueueUnique adds a job unless one with the same name and address
+	// is already pending, returning false if it was coalesced. The job
+	// continues the trace in ctx.
+	enqueueUnique(ctx context.Context, name, serverAddr string) (bool, error)
+	// queues reports the depth and lag of each job queue.
+	queues() ([]*work.Queue, error)
+	// startLane starts workers for the jobs belonging to a lane.
+	startLane(l *lane)
+}
+
+var jobs jobQueue
+
+// redisJobQueue stores jobs in Redis and runs them with gocraft/work.
+type redisJobQueue struct {
+	pool     *redis.Pool
+	enqueuer *work.Enqueuer
+	client   *work.Client
+}
+
+func newRedisJobQueue(pool *redis.Pool) *redisJobQueue {
+	return &redisJobQueue{
+		pool:     pool,
+		enqueuer: work.NewEnqueuer("mcapi", pool),
+		client:   work.NewClient("mcapi", pool),
+	}
+}
+
+func (q *redisJobQueue) enqueueUnique(ctx context.Context, name, serverAddr string) (bool, error) {
+	// Jobs are unique by address alone, as the trace context differs
+	// each time.
+	job, err := q.enqueuer.EnqueueUniqueByKey(name, jobArgs(ctx, serverAddr), work.Q{"serverAddr": serverAddr})
+	if err != nil {
+		return false, err
+	}
+
+	return job != nil, nil
+}
+
+func (q *redisJobQueue) queues() ([]*work.Queue, error) {
+	return q.client.Queues()
+}
+
+// startLane starts a worker pool which only processes jobs for one lane,
+// with as many workers as the lane has slots.
+func (q *redisJobQueue) startLane(l *lane) {
+	pool := work.NewWorkerPool(JobCtx{}, uint(l.capacity()), "mcapi", q.pool)
+
+	pool.Middleware(jobMiddleware)
+
+	pool.Job(laneJobName("query", l.name), laneJob(l, jobUpdate))
+	pool.Job(laneJobName("status", l.name), laneJob(l, jobUpdate))
+
+	go pool.Start()
+}
+
+// memoryJobQueue keeps jobs in process, for running without Redis.
+// Pending jobs are lost on restart unless a state file is configured.
+type memoryJobQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending map[string][]*work.Job
+	unique  map[string]bool
+}
+
+func newMemoryJobQueue() *memoryJobQueue {
+	q := &memoryJobQueue{
+		pending: map[string][]*work.Job{},
+		unique:  map[string]bool{},
+	}
+
+	q.cond = sync.NewCond(&q.mu)
+
+	return q
+}
+
+func (q *memoryJobQueue) enqueueUnique(ctx context.Context, name, serverAddr string) (bool, error) {
+	return q.add(&work.Job{
+		Name:       name,
+		ID:         randomHex(12),
+		EnqueuedAt: time.Now().Unix(),
+		Args:       jobArgs(ctx, serverAddr),
+	}), nil
+}
+
+// add queues a job, returning false if an identical job was pending.
+func (q *memoryJobQueue) add(job *work.Job) bool {
+	key := job.Name + " " + job.ArgString("serverAddr")
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.unique[key] {
+		return false
+	}
+
+	q.unique[key] = true
+	q.pending[job.Name] = append(q.pending[job.Name], job)
+
+	q.cond.Broadcast()
+
+	return true
+}
+
+// take blocks until a job with one of the given names is available. Jobs
+// are taken from whichever queue has been waiting the longest.
+func (q *memoryJobQueue) take(names []string) *work.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		var oldest string
+
+		for _, name := range names {
+			pending := q.pending[name]
+			if len(pending) == 0 {
+				continue
+			}
+
+			if oldest == "" || pending[0].EnqueuedAt < q.pending[oldest][0].EnqueuedAt {
+				oldest = name
+			}
+		}
+
+		if oldest != "" {
+			job := q.pending[oldest][0]
+			q.pending[oldest] = q.pending[oldest][1:]
+
+			delete(q.unique, job.Name+" "+job.ArgString("serverAddr"))
+
+			return job
+		}
+
+		q.cond.Wait()
+	}
+}
+
+// snapshot returns a copy of every pending job.
+func (q *memoryJobQueue) snapshot() []*work.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var all []*work.Job
+	for _, pending := range q.pending {
+		all = append(all, pending...)
+	}
+
+	return all
+}
+
+func (q *memoryJobQueue) queues() ([]*work.Queue, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now().Unix()
+
+	var queues []*work.Queue
+	for name, pending := range q.pending {
+		queue := &work.Queue{
+			JobName: name,
+			Count:   int64(len(pending)),
+		}
+
+		if len(pending) > 0 {
+			queue.Latency = now - pending[0].EnqueuedAt
+		}
+
+		queues = append(queues, queue)
+	}
+
+	return queues, nil
+}
+
+func (q *memoryJobQueue) startLane(l *lane) {
+	names := []string{
+		laneJobName("query", l.name),
+		laneJobName("status", l.name),
+	}
+
+	handler := laneJob(l, jobUpdate)
+
+	for i := 0; i < l.capacity(); i++ {
+		go func() {
+			for {
+				job := q.take(names)
+
+				err := jobMiddleware(job, func() error {
+					return handler(job)
+				})
+
+				if err != nil {
+					slog.Warn("job failed", "job", job.Name, "job_id", job.ID, "err", err)
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gocraft/work"
+)
+
+func TestMemoryJobQueueCoalesces(t *testing.T) {
+	q := newMemoryJobQueue()
+	ctx := context.Background()
+
+	status := laneJobName("status", laneBulk)
+
+	if added, err := q.enqueueUnique(ctx, status, "a:25565"); err != nil || !added {
+		t.Fatalf("expected the first job to be added, got %v %v", added, err)
+	}
+
+	if added, _ := q.enqueueUnique(ctx, status, "a:25565"); added {
+		t.Error("expected a pending job for the same server to be coalesced")
+	}
+
+	if added, _ := q.enqueueUnique(ctx, laneJobName("query", laneBulk), "a:25565"); !added {
+		t.Error("expected a different kind of job to be added")
+	}
+
+	if job := q.take([]string{status}); job.ArgString("serverAddr") != "a:25565" {
+		t.Fatalf("unexpected job %+v", job)
+	}
+
+	if added, _ := q.enqueueUnique(ctx, status, "a:25565"); !added {
+		t.Error("expected a job to be added again once taken")
+	}
+}
+
+func TestMemoryJobQueueOrder(t *testing.T) {
+	q := newMemoryJobQueue()
+
+	now := time.Now().Unix()
+
+	q.add(&work.Job{Name: "b", EnqueuedAt: now, Args: work.Q{"serverAddr": "b:25565"}})
+	q.add(&work.Job{Name: "a", EnqueuedAt: now - 10, Args: work.Q{"serverAddr": "a:25565"}})
+
+	if job := q.take([]string{"a", "b"}); job.Name != "a" {
+		t.Errorf("expected the job which waited longest, got %s", job.Name)
+	}
+
+	queues, _ := q.queues()
+	for _, queue := range queues {
+		if queue.JobName == "b" && queue.Count != 1 {
+			t.Errorf("expected one job pending, got %d", queue.Count)
+		}
+	}
+}
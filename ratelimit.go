@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
+	"strings"
 	"time"
 
 	"github.com/OneOfOne/cmap/stringcmap"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const rateLimitThreshold = 5
@@ -38,7 +41,23 @@ func processRateLimit() {
 	}
 }
 
-func shouldRateLimit(ip string) (bool, int) {
+// rateLimitExempt reports whether a requester is limited by its API key
+// instead of by invalid requests.
+func rateLimitExempt(ip string) bool {
+	return strings.HasPrefix(ip, apiKeyRequester)
+}
+
+func shouldRateLimit(ctx context.Context, ip string) (limited bool, count int) {
+	_, span := tracer.Start(ctx, "rate limit check")
+	defer func() {
+		span.SetAttributes(attribute.Bool("mcapi.rate_limited", limited))
+		span.End()
+	}()
+
+	if rateLimitExempt(ip) {
+		return false, -1
+	}
+
 	item := rateLimit.Get(ip)
 
 	if item == nil {
@@ -47,6 +66,7 @@ func shouldRateLimit(ip string) (bool, int) {
 
 	if i, ok := item.(int); ok {
 		if i > rateLimitThreshold {
+			rateLimitRejections.WithLabelValues(rateLimitIP).Inc()
 			incrRateLimit(ip)
 			return true, i
 		}
@@ -56,11 +76,19 @@ func shouldRateLimit(ip string) (bool, int) {
 }
 
 func incrRateLimit(ip string) {
+	incrRateLimitBy(ip, 1)
+}
+
+func incrRateLimitBy(ip string, n int) {
+	if rateLimitExempt(ip) {
+		return
+	}
+
 	item := rateLimit.Get(ip)
 
 	if item == nil {
-		rateLimit.Set(ip, 1)
+		rateLimit.Set(ip, n)
 	} else if i, ok := item.(int); ok {
-		rateLimit.Set(ip, i + 1)
+		rateLimit.Set(ip, i+n)
 	}
 }
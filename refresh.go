@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+)
+
+const (
+	// refreshTargetInterval is how often one server may be refreshed on
+	// request, and refreshTrustedInterval how often by API keys and the
+	// server's verified owners.
+	refreshTargetInterval  = time.Minute
+	refreshTrustedInterval = 10 * time.Second
+
+	// refreshPruneInterval is how often old refresh limits are forgotten.
+	refreshPruneInterval = 10 * time.Minute
+
+	// ownerHeader is where an owner token is sent.
+	ownerHeader = "X-Owner-Token"
+	// ownerChallengeTTL is how long an owner has to add a verification code
+	// to their MOTD, and ownerTokenTTL how long the token they get lasts.
+	ownerChallengeTTL = time.Hour
+	ownerTokenTTL     = 30 * 24 * time.Hour
+)
+
+// refreshCallerLimit is how many refreshes one caller may make, as a
+// burst and a rate per minute.
+type refreshCallerLimit struct {
+	Burst     float64
+	PerMinute float64
+}
+
+var (
+	refreshAnonymousLimit = refreshCallerLimit{Burst: 5, PerMinute: 0.5}
+	refreshTrustedLimit   = refreshCallerLimit{Burst: 30, PerMinute: 6}
+)
+
+// refreshLimiter limits how often servers may be refreshed on request,
+// both for each server and for each caller.
+type refreshLimiter struct {
+	mu      sync.Mutex
+	targets map[string]time.Time
+	callers map[string]*tokenBucket
+	pruned  time.Time
+}
+
+var refreshes = &refreshLimiter{
+	targets: map[string]time.Time{},
+	callers: map[string]*tokenBucket{},
+}
+
+// allow checks if a caller may refresh a server now, recording the refresh
+// if so. Trusted callers may refresh more often.
+func (r *refreshLimiter) allow(target, caller string, trusted bool, now time.Time) *lookupError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.Sub(r.pruned) > refreshPruneInterval {
+		r.prune(now)
+	}
+
+	interval, limit := refreshTargetInterval, refreshAnonymousLimit
+	if trusted {
+		interval, limit = refreshTrustedInterval, refreshTrustedLimit
+	}
+
+	if since := now.Sub(r.targets[target]); since < interval {
+		rateLimitRejections.WithLabelValues(rateLimitRefreshServer).Inc()
+
+		return &lookupError{
+			Status:   http.StatusTooManyRequests,
+			Code:     types.ErrorRateLimited,
+			Message:  "server was refreshed too recently",
+			TryAfter: int(math.Ceil((interval - since).Seconds())),
+		}
+	}
+
+	bucket, ok := r.callers[caller]
+	if !ok {
+		bucket = newTokenBucket(limit.Burst, now)
+		r.callers[caller] = bucket
+	}
+
+	if tryAfter := bucket.take(limit.PerMinute/60, limit.Burst, now); tryAfter > 0 {
+		rateLimitRejections.WithLabelValues(rateLimitRefreshCaller).Inc()
+
+		return &lookupError{
+			Status:   http.StatusTooManyRequests,
+			Code:     types.ErrorRateLimited,
+			Message:  "too many refreshes",
+			TryAfter: tryAfter,
+		}
+	}
+
+	r.targets[target] = now
+
+	return nil
+}
+
+// prune forgets servers which may be refreshed again and callers whose
+// buckets have refilled. It must be called with the lock held.
+func (r *refreshLimiter) prune(now time.Time) {
+	r.pruned = now
+
+	for target, last := range r.targets {
+		if now.Sub(last) > refreshTargetInterval {
+			delete(r.targets, target)
+		}
+	}
+
+	for caller, bucket := range r.callers {
+		if now.Sub(bucket.last) > refreshPruneInterval {
+			delete(r.callers, caller)
+		}
+	}
+}
+
+// ownerChallenge is a code to add to a server's MOTD. It may only be
+// claimed with the nonce given to whoever requested it.
+type ownerChallenge struct {
+	Address string
+	Code    string
+	Expires time.Time
+}
+
+type ownerToken struct {
+	Address string
+	Expires time.Time
+}
+
+// ownerStore tracks owners who have proven they control a server by adding
+// a code to its MOTD. Challenges and tokens are kept by the hash of their
+// secret, and only in memory, so owners verify again after a restart.
+type ownerStore struct {
+	mu         sync.Mutex
+	challenges map[string]ownerChallenge
+	tokens     map[string]ownerToken
+}
+
+var owners = &ownerStore{
+	challenges: map[string]ownerChallenge{},
+	tokens:     map[string]ownerToken{},
+}
+
+// challenge creates a verification code for a server, returning it with
+// the nonce needed to claim it.
+func (o *ownerStore) challenge(serverAddr string, now time.Time) (string, ownerChallenge) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for hash, challenge := range o.challenges {
+		if now.After(challenge.Expires) {
+			delete(o.challenges, hash)
+		}
+	}
+
+	nonce := randomHex(16)
+	challenge := ownerChallenge{
+		Address: serverAddr,
+		Code:    "mcapi-" + randomHex(4),
+		Expires: now.Add(ownerChallengeTTL),
+	}
+
+	o.challenges[hashAPIKey(nonce)] = challenge
+
+	return nonce, challenge
+}
+
+// pending returns the challenge for a nonce, if it is for the server and
+// has not expired.
+func (o *ownerStore) pending(nonce, serverAddr string, now time.Time) (ownerChallenge, bool) {
+	if nonce == "" {
+		return ownerChallenge{}, false
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	challenge, ok := o.challenges[hashAPIKey(nonce)]
+	if !ok || challenge.Address != serverAddr || now.After(challenge.Expires) {
+		return ownerChallenge{}, false
+	}
+
+	return challenge, true
+}
+
+// verify checks if a server's MOTD contains the code of the challenge for
+// a nonce, and if so returns a token for its owner.
+func (o *ownerStore) verify(nonce, serverAddr, motd string, now time.Time) (string, time.Time, bool) {
+	if nonce == "" {
+		return "", time.Time{}, false
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	hash := hashAPIKey(nonce)
+
+	challenge, ok := o.challenges[hash]
+	if !ok || challenge.Address != serverAddr || now.After(challenge.Expires) ||
+		!strings.Contains(stripFormatting(motd), challenge.Code) {
+		return "", time.Time{}, false
+	}
+
+	delete(o.challenges, hash)
+
+	for hash, token := range o.tokens {
+		if now.After(token.Expires) {
+			delete(o.tokens, hash)
+		}
+	}
+
+	token := randomHex(32)
+	expires := now.Add(ownerTokenTTL)
+
+	o.tokens[hashAPIKey(token)] = ownerToken{
+		Address: serverAddr,
+		Expires: expires,
+	}
+
+	return token, expires, true
+}
+
+// owns checks if a token was issued to the owner of a server.
+func (o *ownerStore) owns(token, serverAddr string, now time.Time) bool {
+	if token == "" {
+		return false
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	owner, ok := o.tokens[hashAPIKey(token)]
+
+	return ok && owner.Address == serverAddr && now.Before(owner.Expires)
+}
+
+// trustedRefresh reports whether a request may refresh a server more
+// often, because it used an API key or came from the server's owner.
+func trustedRefresh(c *gin.Context, serverAddr string) bool {
+	return c.GetString(apiKeyContext) != "" || owners.owns(c.GetHeader(ownerHeader), serverAddr, time.Now())
+}
+
+// wantsRefresh reports whether refresh=true was given.
+func wantsRefresh(c *gin.Context) bool {
+	return c.Query("refresh") == "true"
+}
+
+// refreshStatus pings a server immediately, bypassing the cache.
+func refreshStatus(ctx context.Context, serverAddr, caller string, trusted bool) (*types.ServerStatus, *lookupError) {
+	if err := refreshes.allow("status/"+serverAddr, caller, trusted, time.Now()); err != nil {
+		return nil, err
+	}
+
+	logger(ctx).Info("refreshing status", "server", serverAddr, "requester", caller)
+
+	return probeStatus(ctx, serverAddr, caller)
+}
+
+// refreshQuery queries a server immediately, bypassing the cache.
+func refreshQuery(ctx context.Context, serverAddr, caller string, trusted bool) (*types.ServerQuery, *lookupError) {
+	if err := refreshes.allow("query/"+serverAddr, caller, trusted, time.Now()); err != nil {
+		return nil, err
+	}
+
+	logger(ctx).Info("refreshing query", "server", serverAddr, "requester", caller)
+
+	return probeQuery(ctx, serverAddr, caller)
+}
+
+// requestStatus looks up the status of a server for a request, refreshing
+// it first if refresh=true was given.
+func requestStatus(c *gin.Context, serverAddr string) (*types.ServerStatus, *lookupError) {
+	if wantsRefresh(c) {
+		return refreshStatus(c.Request.Context(), serverAddr, requester(c), trustedRefresh(c, serverAddr))
+	}
+
+	return lookupStatus(c.Request.Context(), serverAddr, requester(c))
+}
+
+// requestQuery looks up the query of a server for a request, refreshing it
+// first if refresh=true was given.
+func requestQuery(c *gin.Context, serverAddr string) (*types.ServerQuery, *lookupError) {
+	if wantsRefresh(c) {
+		return refreshQuery(c.Request.Context(), serverAddr, requester(c), trustedRefresh(c, serverAddr))
+	}
+
+	return lookupQuery(c.Request.Context(), serverAddr, requester(c))
+}
+
+// respondRefresh refreshes the status, or the query if kind=query, of a
+// server immediately.
+func respondRefresh(c *gin.Context) {
+	serverAddr, err := requestAddress(c)
+	if err != nil {
+		render(c, http.StatusBadRequest, &errorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	caller := requester(c)
+	trusted := trustedRefresh(c, serverAddr)
+
+	switch kind := c.Request.Form.Get("kind"); kind {
+	case "", eventStatus:
+		status, lookupErr := refreshStatus(c.Request.Context(), serverAddr, caller, trusted)
+		if status == nil {
+			abortLookup(c, lookupErr)
+			return
+		}
+
+		render(c, http.StatusOK, status)
+	case eventQuery:
+		query, lookupErr := refreshQuery(c.Request.Context(), serverAddr, caller, trusted)
+		if query == nil {
+			abortLookup(c, lookupErr)
+			return
+		}
+
+		render(c, http.StatusOK, query)
+	default:
+		render(c, http.StatusBadRequest, &errorResponse{
+			Error: fmt.Sprintf("unknown kind %s, must be status or query", kind),
+		})
+	}
+}
+
+// ownerVerification is the response to a verification request. Until the
+// code is found in the MOTD, only the code is included, along with the
+// nonce when the code is first given.
+type ownerVerification struct {
+	Address  string    `json:"address"`
+	Verified bool      `json:"verified"`
+	Code     string    `json:"code,omitempty"`
+	Nonce    string    `json:"nonce,omitempty"`
+	Token    string    `json:"token,omitempty"`
+	Expires  time.Time `json:"expires"`
+}
+
+// respondVerifyOwner gives the owner of a server a code to add to its MOTD
+// and a nonce. Once the code has been added, a request with the nonce
+// refreshes the server and gives them a token which lets them refresh it
+// more often.
+func respondVerifyOwner(c *gin.Context) {
+	serverAddr, err := requestAddress(c)
+	if err != nil {
+		render(c, http.StatusBadRequest, &errorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	now := time.Now()
+
+	nonce := c.Request.Form.Get("nonce")
+	if nonce == "" {
+		nonce, challenge := owners.challenge(serverAddr, now)
+
+		render(c, http.StatusAccepted, &ownerVerification{
+			Address: serverAddr,
+			Code:    challenge.Code,
+			Nonce:   nonce,
+			Expires: challenge.Expires,
+		})
+		return
+	}
+
+	challenge, ok := owners.pending(nonce, serverAddr, now)
+	if !ok {
+		render(c, http.StatusBadRequest, &errorResponse{
+			Error: "unknown or expired nonce, request a new code",
+		})
+		return
+	}
+
+	status, lookupErr := refreshStatus(c.Request.Context(), serverAddr, requester(c), false)
+	if status == nil {
+		abortLookup(c, lookupErr)
+		return
+	}
+
+	if token, expires, ok := owners.verify(nonce, serverAddr, status.Motd, now); ok {
+		logger(c.Request.Context()).Info("verified owner", "server", serverAddr)
+
+		render(c, http.StatusOK, &ownerVerification{
+			Address:  serverAddr,
+			Verified: true,
+			Token:    token,
+			Expires:  expires,
+		})
+		return
+	}
+
+	render(c, http.StatusAccepted, &ownerVerification{
+		Address: serverAddr,
+		Code:    challenge.Code,
+		Expires: challenge.Expires,
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/syfaro/mcapi/types"
+)
+
+func TestRefreshLimits(t *testing.T) {
+	limiter := &refreshLimiter{
+		targets: map[string]time.Time{},
+		callers: map[string]*tokenBucket{},
+	}
+
+	now := time.Now()
+
+	if err := limiter.allow("status/a:25565", "192.0.2.1", false, now); err != nil {
+		t.Fatal(err)
+	}
+
+	err := limiter.allow("status/a:25565", "192.0.2.2", false, now.Add(30*time.Second))
+	if err == nil || err.Code != types.ErrorRateLimited || err.TryAfter != 30 {
+		t.Errorf("expected the server to be refreshed too recently, got %v", err)
+	}
+
+	if err := limiter.allow("status/a:25565", "key:abc", true, now.Add(30*time.Second)); err != nil {
+		t.Errorf("expected a trusted caller to refresh sooner, got %v", err)
+	}
+
+	// Anonymous callers may make a burst of refreshes of different servers.
+	for i := 0; i < int(refreshAnonymousLimit.Burst)-1; i++ {
+		target := "status/" + string(rune('b'+i)) + ":25565"
+		if err := limiter.allow(target, "192.0.2.1", false, now); err != nil {
+			t.Fatalf("refresh %d: %v", i, err)
+		}
+	}
+
+	if err := limiter.allow("status/z:25565", "192.0.2.1", false, now); err == nil || err.Message != "too many refreshes" {
+		t.Errorf("expected too many refreshes, got %v", err)
+	}
+}
+
+func TestOwnerVerification(t *testing.T) {
+	store := &ownerStore{
+		challenges: map[string]ownerChallenge{},
+		tokens:     map[string]ownerToken{},
+	}
+
+	now := time.Now()
+
+	nonce, challenge := store.challenge("a:25565", now)
+	if other, again := store.challenge("a:25565", now); other == nonce || again.Code == challenge.Code {
+		t.Error("expected each caller to get their own code")
+	}
+
+	if _, ok := store.pending(nonce, "b:25565", now); ok {
+		t.Error("expected the nonce to only be for its server")
+	}
+
+	if _, _, ok := store.verify(nonce, "a:25565", "§aA Minecraft Server", now); ok {
+		t.Error("expected verification to fail without the code")
+	}
+
+	if _, _, ok := store.verify("", "a:25565", "§aA Minecraft §l"+challenge.Code, now); ok {
+		t.Error("expected verification to fail without the nonce")
+	}
+
+	if _, _, ok := store.verify(nonce, "a:25565", "§aA Minecraft §l"+challenge.Code, now.Add(ownerChallengeTTL+time.Second)); ok {
+		t.Error("expected the challenge to expire")
+	}
+
+	token, _, ok := store.verify(nonce, "a:25565", "§aA Minecraft §l"+challenge.Code, now)
+	if !ok {
+		t.Fatal("expected the code to be found")
+	}
+
+	if _, ok := store.pending(nonce, "a:25565", now); ok {
+		t.Error("expected the challenge to be claimed only once")
+	}
+
+	if !store.owns(token, "a:25565", now) {
+		t.Error("expected the token to own the server")
+	}
+
+	if store.owns(token, "b:25565", now) || store.owns("", "a:25565", now) {
+		t.Error("expected the token to only own its server")
+	}
+
+	if store.owns(token, "a:25565", now.Add(ownerTokenTTL+time.Second)) {
+		t.Error("expected the token to expire")
+	}
+}
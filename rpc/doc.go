@@ -0,0 +1,5 @@
+// Package rpc contains the gRPC service for looking up Minecraft servers,
+// along with a generated client.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative mcapi.proto
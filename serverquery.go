@@ -1,19 +1,21 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/syfaro/mc/mcquery"
 	"github.com/syfaro/mcapi/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func updateQuery(serverAddr string) *types.ServerQuery {
-	log.Printf("Querying %s\n", serverAddr)
+func updateQuery(ctx context.Context, serverAddr string) *types.ServerQuery {
+	logger(ctx).Debug("querying", "server", serverAddr)
 
 	var online bool
 	var veryOld bool
@@ -24,45 +26,46 @@ func updateQuery(serverAddr string) *types.ServerQuery {
 
 	t := time.Now()
 
-	var err error
-	var conn *mcquery.Connection
-	if online {
-		conn, err = mcquery.Connect(serverAddr)
-		if err != nil {
-			isFatal := false
-			errString := err.Error()
-			for _, e := range fatalServerErrors {
-				if strings.Contains(errString, e) {
-					isFatal = true
-				}
-			}
+	ctx, span := tracer.Start(ctx, "query", trace.WithAttributes(attribute.String("mcapi.server", serverAddr)))
 
-			if isFatal {
-				queryMap.Delete(serverAddr)
+	defer func() {
+		observeProbe(eventQuery, status.Online, status.Error, time.Since(t))
+		endProbeSpan(span, status.Online, status.Error)
+	}()
 
-				status.Status = "error"
-				status.Error = "invalid hostname or port"
-				status.Online = false
+	query, err := queryServer(ctx, serverAddr)
 
-				return status
-			}
+	if errors.Is(err, context.Canceled) {
+		status.Status = "error"
+		status.Error = "query was cancelled"
+		status.Online = false
 
-			online = false
-			status.Status = "success"
-			status.Online = false
-			status.LastUpdated = strconv.FormatInt(time.Now().Unix(), 10)
-		}
+		return status
 	}
 
-	var query *mcquery.Stat
-	if online {
-		query, err = conn.FullStat()
-		if err != nil {
-			online = false
-			status.Status = "success"
+	if err != nil {
+		isFatal := false
+		errString := err.Error()
+		for _, e := range fatalServerErrors {
+			if strings.Contains(errString, e) {
+				isFatal = true
+			}
+		}
+
+		if isFatal {
+			queryMap.Delete(serverAddr)
+
+			status.Status = "error"
+			status.Error = errInvalidAddress
 			status.Online = false
-			status.LastUpdated = strconv.FormatInt(time.Now().Unix(), 10)
+
+			return status
 		}
+
+		online = false
+		status.Status = "success"
+		status.Online = false
+		status.LastUpdated = strconv.FormatInt(time.Now().Unix(), 10)
 	}
 
 	if online {
@@ -89,7 +92,7 @@ func updateQuery(serverAddr string) *types.ServerQuery {
 
 		if time.Unix(i, 0).Add(24 * time.Hour).Before(time.Now()) {
 			veryOld = true
-			log.Printf("Very old server %s in database\n", serverAddr)
+			logger(ctx).Info("very old server in database", "server", serverAddr)
 		}
 	}
 
@@ -97,7 +100,8 @@ func updateQuery(serverAddr string) *types.ServerQuery {
 
 	status.Duration = diff.Nanoseconds()
 
-	queryMap.Set(serverAddr, status)
+	previous := queryMap.Swap(serverAddr, status)
+	publishQuery(serverAddr, previous, status)
 
 	if veryOld {
 		queryMap.Delete(serverAddr)
@@ -107,65 +111,34 @@ func updateQuery(serverAddr string) *types.ServerQuery {
 }
 
 func getQueryFromCacheOrUpdate(serverAddr string, c *gin.Context) *types.ServerQuery {
-	serverAddr = strings.ToLower(serverAddr)
-
-	if status, ok := queryMap.GetOK(serverAddr); ok {
-		return status.(*types.ServerQuery)
-	}
-
-	ip := c.GetHeader("CF-Connecting-IP")
+	query, err := requestQuery(c, serverAddr)
 
-	log.Printf("New server %s from %s\n", serverAddr, ip)
-
-	if limit, count := shouldRateLimit(ip); limit {
-		c.AbortWithStatusJSON(http.StatusTooManyRequests, struct{
-			Error string `json:"error"`
-			TryAfter int `json:"try_after"`
-		}{
-			Error: "too many invalid requests",
-			TryAfter: count / rateLimitThreshold,
-		})
+	if query == nil {
+		abortLookup(c, err)
 
 		return nil
 	}
 
-	query := updateQuery(serverAddr)
-
-	if query.Error != "" {
-		incrRateLimit(ip)
-	}
-
 	return query
 }
 
 func respondServerQuery(c *gin.Context) {
-	c.Request.ParseForm()
+	serverAddr, err := requestAddress(c)
 
-	ip := c.Request.Form.Get("ip")
-	port := c.Request.Form.Get("port")
-
-	if ip == "" {
-		c.JSON(http.StatusBadRequest, &types.ServerQuery{
+	if err != nil {
+		render(c, http.StatusBadRequest, &types.ServerQuery{
 			Online: false,
 			Status: "error",
-			Error:  "missing data",
+			Error:  err.Error(),
 		})
 		return
 	}
 
-	var serverAddr string
-
-	if port == "" {
-		serverAddr = ip + ":25565"
-	} else {
-		serverAddr = ip + ":" + port
-	}
-
 	resp := getQueryFromCacheOrUpdate(serverAddr, c)
 
 	if resp == nil {
 		return
 	}
 
-	c.JSON(http.StatusOK, resp)
+	respondSelected(c, queryMap, serverAddr, "v1", resp, resp, resp.LastUpdated)
 }
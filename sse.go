@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+)
+
+const (
+	// sseKeepAlive is how often a comment is sent on an idle stream,
+	// so that proxies do not close it.
+	sseKeepAlive = 30 * time.Second
+	// sseBuffer is how many events may be waiting to be sent before a
+	// stream is considered too slow and is closed.
+	sseBuffer = 64
+)
+
+// respondServerEvents streams status changes for one or more servers as
+// Server-Sent Events. The current status of each server is sent first,
+// followed by an event whenever a refresh changes it.
+func respondServerEvents(c *gin.Context) {
+	serverAddrs, err := batchAddresses(c)
+	if err != nil {
+		render(c, http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Subscribe before looking up the current status, so that no changes
+	// are missed in between.
+	sub := events.subscribe(sseBuffer, serverAddrs...)
+	defer sub.close()
+
+	results, lookupErr := rateLimitedBatchStatus(c.Request.Context(), serverAddrs, requester(c))
+	if lookupErr != nil {
+		abortLookup(c, lookupErr)
+		return
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+
+	for _, serverAddr := range serverAddrs {
+		sendStatusEvent(c, serverAddr, results[serverAddr])
+	}
+
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-sub.events:
+			if !ok {
+				return false
+			}
+
+			if event.Kind != eventStatus {
+				return true
+			}
+
+			// Servers which weren't cached were pinged by the lookup,
+			// which also published the status that was just sent.
+			if status, ok := results[event.Address]; ok {
+				delete(results, event.Address)
+
+				if status == event.Status {
+					return true
+				}
+			}
+
+			c.SSEvent(event.Kind, event)
+
+			return true
+		case <-keepAlive.C:
+			io.WriteString(w, ": keepalive\n\n")
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func sendStatusEvent(c *gin.Context, serverAddr string, status *types.ServerStatus) {
+	if status.Error != "" {
+		c.SSEvent("error", gin.H{
+			"address": serverAddr,
+			"error":   status.Error,
+		})
+		return
+	}
+
+	c.SSEvent(eventStatus, &serverEvent{
+		Kind:    eventStatus,
+		Address: serverAddr,
+		Changes: []string{},
+		Status:  status,
+	})
+}
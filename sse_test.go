@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+)
+
+// waitForSubscribers waits until a server has n subscribers.
+func waitForSubscribers(t *testing.T, address string, n int) {
+	deadline := time.Now().Add(2 * time.Second)
+
+	for time.Now().Before(deadline) {
+		events.mu.RLock()
+		count := len(events.subscribers[address])
+		events.mu.RUnlock()
+
+		if count >= n {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("expected %d subscribers for %s", n, address)
+}
+
+func TestServerEventsSkipInitialStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	initial := &types.ServerStatus{Status: "success", Online: true, LastUpdated: now}
+	initial.Players.Now = 3
+
+	pingMap = newServerCache(0, 0)
+	pingMap.Set("sse.example.com:25565", initial)
+
+	router := gin.New()
+	router.GET("/server/events", respondServerEvents)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/server/events?address=sse.example.com", nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	waitForSubscribers(t, "sse.example.com:25565", 1)
+
+	updated := *initial
+	updated.Players.Now = 4
+
+	// The first is what a lookup which pinged the server would publish.
+	events.publish(&serverEvent{Kind: eventStatus, Address: "sse.example.com:25565", Changes: []string{}, Status: initial})
+	events.publish(&serverEvent{Kind: eventStatus, Address: "sse.example.com:25565", Changes: []string{"players"}, Status: &updated})
+
+	var statuses []string
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() && len(statuses) < 2 {
+		if line := scanner.Text(); strings.HasPrefix(line, "data:") {
+			statuses = append(statuses, line)
+		}
+	}
+
+	if len(statuses) != 2 {
+		t.Fatalf("expected two events, got %v", statuses)
+	}
+
+	if !strings.Contains(statuses[0], `"now":3`) || !strings.Contains(statuses[1], `"now":4`) {
+		t.Errorf("expected the initial status once followed by the change, got %v", statuses)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"github.com/gocraft/work"
+)
+
+// stateSaveInterval is how often standalone state is written to disk.
+const stateSaveInterval = time.Minute
+
+// standaloneState is everything needed to resume a standalone instance:
+// the request counter, jobs which had not yet run and the servers being
+// tracked by the scheduler.
+type standaloneState struct {
+	Requests int64       `json:"requests"`
+	Jobs     []*work.Job `json:"jobs"`
+	Status   []string    `json:"status"`
+	Query    []string    `json:"query"`
+}
+
+// loadState restores a previously saved state. A missing file is not an
+// error, as it will be created on the first save.
+func loadState(path string, queue *memoryJobQueue, requests *memoryCounter) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		slog.Error("unable to read state file", "path", path, "err", err)
+		return
+	}
+
+	var state standaloneState
+	if err := json.Unmarshal(data, &state); err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		slog.Error("unable to parse state file", "path", path, "err", err)
+		return
+	}
+
+	requests.set(state.Requests)
+
+	for _, job := range state.Jobs {
+		queue.add(job)
+	}
+
+	// Cached results are not saved, so refresh every tracked server to
+	// add it back to the cache.
+	for _, serverAddr := range state.Status {
+		queue.enqueueUnique(context.Background(), laneJobName("status", laneBulk), serverAddr)
+	}
+
+	for _, serverAddr := range state.Query {
+		queue.enqueueUnique(context.Background(), laneJobName("query", laneBulk), serverAddr)
+	}
+
+	slog.Info("loaded state", "jobs", len(state.Jobs), "servers", len(state.Status)+len(state.Query))
+}
+
+// saveState writes the current state to path, replacing it atomically.
+func saveState(path string, queue *memoryJobQueue, requests *memoryCounter) error {
+	state := standaloneState{
+		Jobs: queue.snapshot(),
+	}
+
+	pingMap.ForEachLocked(func(key string, _ interface{}) bool {
+		state.Status = append(state.Status, key)
+		return true
+	})
+
+	queryMap.ForEachLocked(func(key string, _ interface{}) bool {
+		state.Query = append(state.Query, key)
+		return true
+	})
+
+	state.Requests, _ = requests.get()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func persistState(path string, queue *memoryJobQueue, requests *memoryCounter) {
+	for range time.Tick(stateSaveInterval) {
+		if err := saveState(path, queue, requests); err != nil {
+			raven.CaptureError(err, nil)
+			slog.Error("unable to save state file", "path", path, "err", err)
+		}
+	}
+}
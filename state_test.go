@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/syfaro/mcapi/types"
+)
+
+func TestStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	pingMap = newServerCache(0, 0)
+	pingMap.Set("a:25565", &types.ServerStatus{})
+	pingMap.Set("b:25565", &types.ServerStatus{})
+
+	queryMap = newServerCache(0, 0)
+	queryMap.Set("a:25565", &types.ServerQuery{})
+
+	queue := newMemoryJobQueue()
+	queue.enqueueUnique(context.Background(), laneJobName("status", laneInteractive), "c:25565")
+
+	requests := &memoryCounter{}
+	requests.set(42)
+
+	if err := saveState(path, queue, requests); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newMemoryJobQueue()
+	restoredRequests := &memoryCounter{}
+
+	loadState(path, restored, restoredRequests)
+
+	if count, _ := restoredRequests.get(); count != 42 {
+		t.Errorf("expected the request count to be restored, got %d", count)
+	}
+
+	jobs := map[string]bool{}
+	for _, job := range restored.snapshot() {
+		jobs[job.Name+" "+job.ArgString("serverAddr")] = true
+	}
+
+	for _, want := range []string{
+		"status_interactive c:25565",
+		"status a:25565",
+		"status b:25565",
+		"query a:25565",
+	} {
+		if !jobs[want] {
+			t.Errorf("expected a %s job after restoring, got %v", want, jobs)
+		}
+	}
+}
+
+func TestLoadMissingState(t *testing.T) {
+	queue := newMemoryJobQueue()
+	requests := &memoryCounter{}
+
+	loadState(filepath.Join(t.TempDir(), "missing.json"), queue, requests)
+
+	if len(queue.snapshot()) != 0 {
+		t.Error("expected no jobs without a state file")
+	}
+}
@@ -2,7 +2,8 @@ package main
 
 import (
 	"bytes"
-	"log"
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -10,11 +11,12 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/syfaro/mcapi/types"
-	"github.com/syfaro/minepong"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func updatePing(serverAddr string) *types.ServerStatus {
-	log.Printf("Pinging %s\n", serverAddr)
+func updatePing(ctx context.Context, serverAddr string) *types.ServerStatus {
+	logger(ctx).Debug("pinging", "server", serverAddr)
 
 	var online bool
 	var veryOld bool
@@ -25,7 +27,22 @@ func updatePing(serverAddr string) *types.ServerStatus {
 
 	t := time.Now()
 
-	pong, err := minepong.Ping(serverAddr)
+	ctx, span := tracer.Start(ctx, "ping", trace.WithAttributes(attribute.String("mcapi.server", serverAddr)))
+
+	defer func() {
+		observeProbe(eventStatus, status.Online, status.Error, time.Since(t))
+		endProbeSpan(span, status.Online, status.Error)
+	}()
+
+	pong, err := pingServer(ctx, serverAddr)
+
+	if errors.Is(err, context.Canceled) {
+		status.Status = "error"
+		status.Error = "ping was cancelled"
+		status.Online = false
+
+		return status
+	}
 
 	if err != nil {
 		isFatal := false
@@ -40,7 +57,7 @@ func updatePing(serverAddr string) *types.ServerStatus {
 			pingMap.Delete(serverAddr)
 
 			status.Status = "error"
-			status.Error = "invalid hostname or port"
+			status.Error = errInvalidAddress
 			status.Online = false
 
 			return status
@@ -118,8 +135,7 @@ func updatePing(serverAddr string) *types.ServerStatus {
 				status.Motd = val.(string)
 			}
 		default:
-			log.Printf("strange motd on server %s\n", serverAddr)
-			log.Printf("%v", pong.Description)
+			logger(ctx).Warn("strange motd", "server", serverAddr, "description", pong.Description)
 			status.Motd = ""
 		}
 		status.Favicon = pong.FavIcon
@@ -138,7 +154,7 @@ func updatePing(serverAddr string) *types.ServerStatus {
 
 		if time.Unix(i, 0).Add(24 * time.Hour).Before(time.Now()) {
 			veryOld = true
-			log.Printf("Very old server %s in database\n", serverAddr)
+			logger(ctx).Info("very old server in database", "server", serverAddr)
 		}
 	}
 
@@ -146,7 +162,10 @@ func updatePing(serverAddr string) *types.ServerStatus {
 
 	status.Duration = diff.Nanoseconds()
 
-	pingMap.Set(serverAddr, status)
+	previous := pingMap.Swap(serverAddr, status)
+	publishStatus(serverAddr, previous, status)
+	history.record(serverAddr, status)
+	webhooks.observe(serverAddr, status, time.Now())
 
 	if veryOld {
 		pingMap.Delete(serverAddr)
@@ -156,67 +175,37 @@ func updatePing(serverAddr string) *types.ServerStatus {
 }
 
 func getStatusFromCacheOrUpdate(serverAddr string, c *gin.Context, hideError bool) *types.ServerStatus {
-	serverAddr = strings.ToLower(serverAddr)
-
-	if status, ok := pingMap.GetOK(serverAddr); ok {
-		return status.(*types.ServerStatus)
-	}
-
-	ip := c.GetHeader("CF-Connecting-IP")
-
-	log.Printf("New server %s from %s\n", serverAddr, ip)
+	status, err := lookupStatus(c.Request.Context(), serverAddr, requester(c))
 
-	if limit, count := shouldRateLimit(ip); limit {
+	if status == nil {
 		if !hideError {
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, struct {
-				Error    string `json:"error"`
-				TryAfter int    `json:"try_after"`
-			}{
-				Error:    "too many invalid requests",
-				TryAfter: count / rateLimitThreshold,
-			})
+			abortLookup(c, err)
 		}
 
 		return nil
 	}
 
-	status := updatePing(serverAddr)
-
-	if status.Error != "" {
-		incrRateLimit(ip)
-	}
-
 	return status
 }
 
 func respondServerStatus(c *gin.Context) {
-	c.Request.ParseForm()
-
-	ip := c.Request.Form.Get("ip")
-	port := c.Request.Form.Get("port")
+	serverAddr, err := requestAddress(c)
 
-	if ip == "" {
-		c.JSON(http.StatusBadRequest, &types.ServerStatus{
+	if err != nil {
+		render(c, http.StatusBadRequest, &types.ServerStatus{
 			Online: false,
 			Status: "error",
-			Error:  "missing data",
+			Error:  err.Error(),
 		})
 		return
 	}
 
-	var serverAddr string
-
-	if port == "" {
-		serverAddr = ip + ":25565"
-	} else {
-		serverAddr = ip + ":" + port
-	}
-
-	status := getStatusFromCacheOrUpdate(serverAddr, c, false)
+	status, lookupErr := requestStatus(c, serverAddr)
 
 	if status == nil {
+		abortLookup(c, lookupErr)
 		return
 	}
 
-	c.JSON(http.StatusOK, status)
+	respondSelected(c, pingMap, serverAddr, "v1", status, status, status.LastUpdated)
 }
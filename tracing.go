@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocraft/work"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	traceExporterOTLP   = "otlp"
+	traceExporterStdout = "stdout"
+)
+
+// tracer creates every span. Until setupTracing configures an exporter,
+// spans are not recorded.
+var tracer = otel.Tracer("github.com/syfaro/mcapi")
+
+func init() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// setupTracing exports spans to an OTLP collector over gRPC, or to stdout
+// for local debugging. It returns a function which flushes any spans not yet
+// exported.
+func setupTracing(cfg *Config) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch cfg.TraceExporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case traceExporterOTLP:
+		var opts []otlptracegrpc.Option
+		if cfg.TraceEndpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.TraceEndpoint))
+		}
+		if cfg.TraceInsecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+
+		exporter, err = otlptracegrpc.New(context.Background(), opts...)
+	case traceExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		err = fmt.Errorf("unknown trace exporter %s, must be otlp or stdout", cfg.TraceExporter)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	ratio := cfg.TraceSampleRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "mcapi"))),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// endSpan records err on a span, if there was one, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// endProbeSpan ends the span of a ping or query, recording the error it
+// recorded, if any.
+func endProbeSpan(span trace.Span, online bool, errorMessage string) {
+	span.SetAttributes(attribute.Bool("mcapi.online", online))
+
+	if errorMessage != "" {
+		span.SetStatus(codes.Error, errorMessage)
+	}
+
+	span.End()
+}
+
+// traceStep runs one step of a probe in its own span.
+func traceStep(ctx context.Context, name string, fn func() error) error {
+	_, span := tracer.Start(ctx, name)
+
+	err := fn()
+	endSpan(span, err)
+
+	return err
+}
+
+// traceRequests starts a span for each request, continuing the caller's
+// trace if it sent a traceparent header.
+func traceRequests(c *gin.Context) {
+	ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+	route := requestRoute(c)
+
+	ctx, span := tracer.Start(ctx, c.Request.Method+" "+route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", route),
+			attribute.String("url.path", c.Request.URL.Path),
+		))
+	defer span.End()
+
+	c.Request = c.Request.WithContext(ctx)
+
+	c.Next()
+
+	status := c.Writer.Status()
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+
+	if err := c.Errors.Last(); err != nil {
+		span.RecordError(err)
+	}
+
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// jobCarrier carries trace context in a job's arguments, so a job continues
+// the trace which enqueued it.
+type jobCarrier map[string]interface{}
+
+func (c jobCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+func (c jobCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c jobCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// jobArgs creates the arguments of a refresh job for a server, including
+// the trace context from ctx.
+func jobArgs(ctx context.Context, serverAddr string) map[string]interface{} {
+	args := work.Q{"serverAddr": serverAddr}
+	otel.GetTextMapPropagator().Inject(ctx, jobCarrier(args))
+
+	return args
+}
+
+// startJobSpan starts a span for running a job, as part of the trace which
+// enqueued it.
+func startJobSpan(job *work.Job) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), jobCarrier(job.Args))
+
+	return tracer.Start(ctx, "job "+job.Name,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("mcapi.job_id", job.ID),
+			attribute.String("mcapi.server", job.ArgString("serverAddr")),
+		))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+	spanRecorder     = tracetest.NewSpanRecorder()
+	spanRecorderOnce sync.Once
+)
+
+// recordSpans records spans from now on, returning a function which gives
+// the spans which have ended since, by name. The tracer only uses the first
+// provider set, so every test shares one recorder.
+func recordSpans() func() map[string]sdktrace.ReadOnlySpan {
+	spanRecorderOnce.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+	})
+
+	seen := len(spanRecorder.Ended())
+
+	return func() map[string]sdktrace.ReadOnlySpan {
+		spans := map[string]sdktrace.ReadOnlySpan{}
+		for _, span := range spanRecorder.Ended()[seen:] {
+			spans[span.Name()] = span
+		}
+
+		return spans
+	}
+}
+
+func TestTraceRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	endedSpans := recordSpans()
+
+	router := gin.New()
+	router.Use(traceRequests)
+	router.GET("/server/status/:address", func(c *gin.Context) {
+		shouldRateLimit(c.Request.Context(), "192.0.2.1")
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/server/status/example.com", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := endedSpans()
+
+	request, ok := spans["GET /server/status/:address"]
+	if !ok {
+		t.Fatalf("expected a span for the request, got %v", spans)
+	}
+
+	if request.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected the caller's trace to be continued, got %s", request.SpanContext().TraceID())
+	}
+
+	check, ok := spans["rate limit check"]
+	if !ok || check.Parent().SpanID() != request.SpanContext().SpanID() {
+		t.Errorf("expected the rate limit check to be part of the request")
+	}
+}
+
+func TestTraceJobs(t *testing.T) {
+	endedSpans := recordSpans()
+
+	queue := newMemoryJobQueue()
+
+	ctx, span := tracer.Start(context.Background(), "enqueue")
+	queue.enqueueUnique(ctx, laneJobName("status", laneInteractive), "example.com:25565")
+	span.End()
+
+	job := queue.take([]string{laneJobName("status", laneInteractive)})
+
+	_, jobSpan := startJobSpan(job)
+	jobSpan.End()
+
+	spans := endedSpans()
+
+	run, ok := spans["job "+job.Name]
+	if !ok {
+		t.Fatalf("expected a span for the job, got %v", spans)
+	}
+
+	if run.Parent().SpanID() != span.SpanContext().SpanID() || run.SpanContext().TraceID() != span.SpanContext().TraceID() {
+		t.Error("expected the job to continue the trace which enqueued it")
+	}
+}
+
+func TestTraceDial(t *testing.T) {
+	endedSpans := recordSpans()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	_, done, err := dialServer(context.Background(), "tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	done()
+
+	spans := endedSpans()
+
+	for _, name := range []string{"dns", "connect"} {
+		if _, ok := spans[name]; !ok {
+			t.Errorf("expected a %s span, got %v", name, spans)
+		}
+	}
+}
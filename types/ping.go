@@ -50,3 +50,17 @@ func (s ServerStatus) Image() (image.Image, error) {
 	img, _, err := image.Decode(reader)
 	return img, err
 }
+
+// FaviconPNG returns the encoded favicon, which is a PNG image.
+func (s ServerStatus) FaviconPNG() ([]byte, error) {
+	data := s.Favicon[strings.IndexByte(s.Favicon, ',')+1:]
+	return base64.StdEncoding.DecodeString(data)
+}
+
+// ServerStatusBatch contains the status of many servers, keyed by address.
+// Each entry has its own status and error fields.
+type ServerStatusBatch struct {
+	Status  string                   `json:"status"`
+	Error   string                   `json:"error,omitempty"`
+	Servers map[string]*ServerStatus `json:"servers"`
+}
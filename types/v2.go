@@ -0,0 +1,147 @@
+package types
+
+import (
+	"strconv"
+	"time"
+)
+
+// ErrorCode identifies why a v2 request failed.
+type ErrorCode string
+
+const (
+	// ErrorMissingAddress means no server address was provided.
+	ErrorMissingAddress ErrorCode = "missing_address"
+	// ErrorInvalidAddress means the address could not be resolved or connected to.
+	ErrorInvalidAddress ErrorCode = "invalid_address"
+	// ErrorInvalidRequest means the request could not be understood.
+	ErrorInvalidRequest ErrorCode = "invalid_request"
+	// ErrorRateLimited means too many invalid requests were made, see TryAfter.
+	ErrorRateLimited ErrorCode = "rate_limited"
+	// ErrorUnavailable means the server could not be checked right now.
+	ErrorUnavailable ErrorCode = "unavailable"
+	// ErrorInvalidKey means the API key is unknown or was revoked.
+	ErrorInvalidKey ErrorCode = "invalid_key"
+	// ErrorForbidden means the API key may not be used for the request.
+	ErrorForbidden ErrorCode = "forbidden"
+)
+
+// ErrorV2 describes why a v2 request failed.
+type ErrorV2 struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// TryAfter is the number of seconds to wait before retrying, when rate limited.
+	TryAfter int `json:"try_after,omitempty"`
+}
+
+// ErrorResponseV2 is the body of every unsuccessful v2 response.
+type ErrorResponseV2 struct {
+	Error *ErrorV2 `json:"error"`
+}
+
+// ServerStatusV2 contains all information available from a ping request.
+// Unlike ServerStatus, failures are reported with an HTTP status code and
+// an ErrorResponseV2 instead of in the status itself.
+type ServerStatusV2 struct {
+	Address       string              `json:"address"`
+	Online        bool                `json:"online"`
+	Motd          string              `json:"motd"`
+	MotdExtra     interface{}         `json:"motd_extra,omitempty"`
+	MotdFormatted string              `json:"motd_formatted,omitempty"`
+	Favicon       string              `json:"favicon,omitempty"`
+	Players       ServerStatusPlayers `json:"players"`
+	Server        ServerStatusServer  `json:"server"`
+	// LastOnline is nil if the server has never been seen online.
+	LastOnline      *time.Time `json:"last_online"`
+	LastOnlineUnix  int64      `json:"last_online_unix,omitempty"`
+	LastUpdated     time.Time  `json:"last_updated"`
+	LastUpdatedUnix int64      `json:"last_updated_unix"`
+	// DurationMs is how long the ping took, in milliseconds.
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// ServerQueryV2 contains all information available from a query request.
+type ServerQueryV2 struct {
+	Address         string             `json:"address"`
+	Online          bool               `json:"online"`
+	Motd            string             `json:"motd"`
+	Version         string             `json:"version"`
+	GameType        string             `json:"game_type"`
+	GameID          string             `json:"game_id"`
+	ServerMod       string             `json:"server_mod"`
+	Map             string             `json:"map"`
+	Players         ServerQueryPlayers `json:"players"`
+	Plugins         []string           `json:"plugins"`
+	LastOnline      *time.Time         `json:"last_online"`
+	LastOnlineUnix  int64              `json:"last_online_unix,omitempty"`
+	LastUpdated     time.Time          `json:"last_updated"`
+	LastUpdatedUnix int64              `json:"last_updated_unix"`
+	DurationMs      float64            `json:"duration_ms"`
+}
+
+// ServerStatusBatchV2 contains the status of many servers, keyed by address.
+// Each address appears in exactly one of Servers and Errors.
+type ServerStatusBatchV2 struct {
+	Servers map[string]*ServerStatusV2 `json:"servers"`
+	Errors  map[string]*ErrorV2        `json:"errors"`
+}
+
+// V2 converts a status into its v2 form.
+func (s *ServerStatus) V2(address string) *ServerStatusV2 {
+	v2 := &ServerStatusV2{
+		Address:       address,
+		Online:        s.Online,
+		Motd:          s.Motd,
+		MotdExtra:     s.MotdExtra,
+		MotdFormatted: s.MotdFormatted,
+		Favicon:       s.Favicon,
+		Players:       s.Players,
+		Server:        s.Server,
+		DurationMs:    durationMs(s.Duration),
+	}
+
+	v2.LastOnline, v2.LastOnlineUnix = parseTimestamp(s.LastOnline)
+	if updated, unix := parseTimestamp(s.LastUpdated); updated != nil {
+		v2.LastUpdated, v2.LastUpdatedUnix = *updated, unix
+	}
+
+	return v2
+}
+
+// V2 converts a query into its v2 form.
+func (q *ServerQuery) V2(address string) *ServerQueryV2 {
+	v2 := &ServerQueryV2{
+		Address:    address,
+		Online:     q.Online,
+		Motd:       q.Motd,
+		Version:    q.Version,
+		GameType:   q.GameType,
+		GameID:     q.GameID,
+		ServerMod:  q.ServerMod,
+		Map:        q.Map,
+		Players:    q.Players,
+		Plugins:    q.Plugins,
+		DurationMs: durationMs(q.Duration),
+	}
+
+	v2.LastOnline, v2.LastOnlineUnix = parseTimestamp(q.LastOnline)
+	if updated, unix := parseTimestamp(q.LastUpdated); updated != nil {
+		v2.LastUpdated, v2.LastUpdatedUnix = *updated, unix
+	}
+
+	return v2
+}
+
+// parseTimestamp parses a v1 timestamp, Unix seconds as a string.
+func parseTimestamp(value string) (*time.Time, int64) {
+	unix, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || unix == 0 {
+		return nil, 0
+	}
+
+	t := time.Unix(unix, 0).UTC()
+	return &t, unix
+}
+
+func durationMs(nanoseconds int64) float64 {
+	return float64(nanoseconds) / float64(time.Millisecond)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+)
+
+// registerV2 adds the v2 API, which reports failures with HTTP status codes
+// and structured errors, and uses RFC3339 timestamps and millisecond durations.
+func registerV2(router *gin.Engine) {
+	v2 := router.Group("/v2")
+
+	v2.GET("/server/status", respondServerStatusV2)
+	v2.GET("/server/status/:address", respondServerStatusV2)
+	v2.GET("/server/query", respondServerQueryV2)
+	v2.GET("/server/query/:address", respondServerQueryV2)
+
+	v2.GET("/server/status/batch", respondServerStatusBatchV2)
+	v2.POST("/server/status/batch", respondServerStatusBatchV2)
+}
+
+func abortV2(c *gin.Context, err *lookupError) {
+	abortRender(c, err.Status, &types.ErrorResponseV2{
+		Error: err.v2(),
+	})
+}
+
+// addressV2 reads the server address using the same parameters as v1.
+func addressV2(c *gin.Context) (string, *lookupError) {
+	serverAddr, err := requestAddress(c)
+
+	if err == errMissingAddress {
+		return "", &lookupError{
+			Status:  http.StatusBadRequest,
+			Code:    types.ErrorMissingAddress,
+			Message: "missing server address",
+		}
+	} else if err != nil {
+		return "", &lookupError{
+			Status:  http.StatusBadRequest,
+			Code:    types.ErrorInvalidAddress,
+			Message: err.Error(),
+		}
+	}
+
+	return serverAddr, nil
+}
+
+func respondServerStatusV2(c *gin.Context) {
+	serverAddr, err := addressV2(c)
+	if err != nil {
+		abortV2(c, err)
+		return
+	}
+
+	status, err := requestStatus(c, serverAddr)
+	if err != nil {
+		abortV2(c, err)
+		return
+	}
+
+	respondSelected(c, pingMap, serverAddr, "v2", status, status.V2(serverAddr), status.LastUpdated)
+}
+
+func respondServerQueryV2(c *gin.Context) {
+	serverAddr, err := addressV2(c)
+	if err != nil {
+		abortV2(c, err)
+		return
+	}
+
+	query, err := requestQuery(c, serverAddr)
+	if err != nil {
+		abortV2(c, err)
+		return
+	}
+
+	respondSelected(c, queryMap, serverAddr, "v2", query, query.V2(serverAddr), query.LastUpdated)
+}
+
+func respondServerStatusBatchV2(c *gin.Context) {
+	serverAddrs, parseErr := batchAddresses(c)
+	if parseErr != nil {
+		abortV2(c, &lookupError{
+			Status:  http.StatusBadRequest,
+			Code:    types.ErrorInvalidRequest,
+			Message: parseErr.Error(),
+		})
+		return
+	}
+
+	results, err := rateLimitedBatchStatus(c.Request.Context(), serverAddrs, requester(c))
+	if err != nil {
+		abortV2(c, err)
+		return
+	}
+
+	sel := requestFields(c, batchDefaultExclude...)
+
+	batch := &trimmedBatchV2{
+		Servers: map[string]json.RawMessage{},
+		Errors:  map[string]*types.ErrorV2{},
+	}
+
+	for serverAddr, status := range results {
+		if status.Error != "" {
+			batch.Errors[serverAddr] = probeFailure(status.Error).v2()
+			continue
+		}
+
+		data, err := sel.trimmed(pingMap, serverAddr, "v2", status, status.V2(serverAddr))
+		if err != nil {
+			c.Error(err)
+			continue
+		}
+
+		batch.Servers[serverAddr] = data
+	}
+
+	render(c, http.StatusOK, batch)
+}
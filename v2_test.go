@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+)
+
+func v2Router() *gin.Engine {
+	router := fieldsRouter()
+	pingMap.Set("down.example.com:25565", &types.ServerStatus{
+		Status:      "error",
+		Error:       "connection refused",
+		LastUpdated: "0",
+	})
+
+	registerV2(router)
+
+	return router
+}
+
+func TestV2AddressErrors(t *testing.T) {
+	router := v2Router()
+
+	tests := []struct {
+		path string
+		code types.ErrorCode
+	}{
+		{"/v2/server/status", types.ErrorMissingAddress},
+		{"/v2/server/status?ip=example.com&port=notaport", types.ErrorInvalidAddress},
+		{"/v2/server/query/example.com:0", types.ErrorInvalidAddress},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", test.path, w.Code)
+		}
+
+		var resp types.ErrorResponseV2
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Error == nil || resp.Error.Code != test.code {
+			t.Errorf("%s: expected code %s, got %+v", test.path, test.code, resp.Error)
+		}
+	}
+}
+
+func TestV2Status(t *testing.T) {
+	router := v2Router()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/server/status/example.com", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp["address"] != "example.com:25565" {
+		t.Errorf("unexpected address %v", resp["address"])
+	}
+
+	if updated, _ := resp["last_updated"].(string); updated == "" {
+		t.Error("expected last_updated to be set")
+	} else if _, err := time.Parse(time.RFC3339, updated); err != nil {
+		t.Errorf("expected an RFC3339 timestamp, got %s", updated)
+	}
+}
+
+func TestV2BatchErrors(t *testing.T) {
+	router := v2Router()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/server/status/batch?address=example.com&address=down.example.com", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	var batch types.ServerStatusBatchV2
+	if err := json.Unmarshal(w.Body.Bytes(), &batch); err != nil {
+		t.Fatal(err)
+	}
+
+	if batch.Servers["example.com:25565"] == nil {
+		t.Error("expected the online server to be included")
+	}
+
+	if e := batch.Errors["down.example.com:25565"]; e == nil || e.Code != types.ErrorUnavailable {
+		t.Errorf("expected the failed server to be reported as unavailable, got %+v", e)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/server/status/batch", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected a missing address list to be rejected, got %d", w.Code)
+	}
+}
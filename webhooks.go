@@ -0,0 +1,896 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+)
+
+// Webhook events, which are also the names used in event filters.
+const (
+	webhookOffline     = "offline"
+	webhookOnline      = "online"
+	webhookPlayersUp   = "players_above"
+	webhookPlayersDown = "players_below"
+	webhookMotd        = "motd"
+	webhookVersion     = "version"
+)
+
+var webhookEventNames = []string{
+	webhookOffline,
+	webhookOnline,
+	webhookPlayersUp,
+	webhookPlayersDown,
+	webhookMotd,
+	webhookVersion,
+}
+
+const (
+	webhookFormatDefault = "default"
+	webhookFormatDiscord = "discord"
+)
+
+const (
+	// webhookAttempts is how many times a delivery is tried, waiting
+	// webhookBackoff after the first failure and doubling each time.
+	webhookAttempts = 5
+	webhookBackoff  = 2 * time.Second
+	// webhookMaxFailures is how many deliveries in a row may fail before
+	// a webhook is disabled.
+	webhookMaxFailures = 10
+	// webhookLogSize is how many deliveries are kept in a webhook's log.
+	webhookLogSize = 25
+	// webhookMaxPerAddress is the most webhooks one server may have, and
+	// webhookMaxPerRequester the most one caller may create.
+	webhookMaxPerAddress   = 10
+	webhookMaxPerRequester = 10
+	// webhookUnreachableTTL is how long a server may fail every refresh
+	// before its webhooks are removed.
+	webhookUnreachableTTL = 7 * 24 * time.Hour
+
+	// webhookWorkers is how many deliveries are made at once, and
+	// webhookMaxPending how many may be queued or waiting to be retried
+	// before new events are dropped.
+	webhookWorkers    = 8
+	webhookMaxPending = 1000
+
+	defaultWebhookMax = 10000
+)
+
+// webhookMax is the most webhooks which may exist at once.
+var webhookMax = defaultWebhookMax
+
+// webhookKey is what the secret of each webhook is derived from, so that
+// secrets are never saved. Unless it is configured, secrets change on
+// restart.
+var webhookKey = []byte(randomHex(32))
+
+var (
+	errTooManyWebhooks          = errors.New("too many webhooks, try again later")
+	errTooManyAddressWebhooks   = errors.New("too many webhooks for this server")
+	errTooManyRequesterWebhooks = errors.New("too many webhooks created by this caller")
+)
+
+// webhook is a URL which is notified when a server changes.
+type webhook struct {
+	ID      string   `json:"id"`
+	URL     string   `json:"url"`
+	Address string   `json:"address"`
+	Events  []string `json:"events"`
+	// PlayerThreshold is the player count for players_above and
+	// players_below events.
+	PlayerThreshold int    `json:"player_threshold,omitempty"`
+	Format          string `json:"format"`
+	// Secret is only set when the webhook is created, as it is derived
+	// from the ID.
+	Secret  string    `json:"secret,omitempty"`
+	Created time.Time `json:"created"`
+	// Creator is a hash of the requester which created the webhook.
+	Creator string `json:"creator,omitempty"`
+
+	Disabled       bool   `json:"disabled"`
+	DisabledReason string `json:"disabled_reason,omitempty"`
+	Failures       int    `json:"failures"`
+
+	Deliveries []*webhookDelivery `json:"deliveries,omitempty"`
+}
+
+// webhookDelivery is one attempt at delivering an event.
+type webhookDelivery struct {
+	ID         string    `json:"id"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs float64   `json:"duration_ms"`
+}
+
+type webhookRequest struct {
+	URL             string   `json:"url"`
+	Address         string   `json:"address"`
+	Events          []string `json:"events"`
+	PlayerThreshold int      `json:"player_threshold"`
+	Format          string   `json:"format"`
+}
+
+// webhookPayload is the body of a default format delivery.
+type webhookPayload struct {
+	ID        string                `json:"id"`
+	Event     string                `json:"event"`
+	Address   string                `json:"address"`
+	Timestamp time.Time             `json:"timestamp"`
+	Status    *types.ServerStatusV2 `json:"status"`
+}
+
+// webhookStore holds every webhook, optionally saving them to a file.
+type webhookStore struct {
+	mu       sync.Mutex
+	path     string
+	webhooks map[string]*webhook
+
+	// watched is how many webhooks each server has.
+	watched map[string]int
+	// last is the last status seen for each server with a webhook, so
+	// changes are found even if the server was evicted from the cache
+	// in between.
+	last map[string]*types.ServerStatus
+	// failing is when each server with a webhook started failing to
+	// respond, if it has not responded since.
+	failing map[string]time.Time
+}
+
+var webhooks = newWebhookStore()
+
+func newWebhookStore() *webhookStore {
+	return &webhookStore{
+		webhooks: map[string]*webhook{},
+		watched:  map[string]int{},
+		last:     map[string]*types.ServerStatus{},
+		failing:  map[string]time.Time{},
+	}
+}
+
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: rejectPrivateAddress,
+		}).DialContext,
+	},
+}
+
+// rejectPrivateAddress prevents webhooks from being used to make requests
+// to the network mcapi is running on.
+func rejectPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return fmt.Errorf("webhook address %s is not allowed", host)
+	}
+
+	return nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// load reads webhooks from a file, which is then kept up to date.
+func (s *webhookStore) load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.path = path
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var saved []*webhook
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	for _, hook := range saved {
+		s.webhooks[hook.ID] = hook
+		s.watched[hook.Address]++
+	}
+
+	return nil
+}
+
+// save writes every webhook to the file, if there is one. It must be
+// called with the lock held.
+func (s *webhookStore) save() {
+	if s.path == "" {
+		return
+	}
+
+	saved := make([]*webhook, 0, len(s.webhooks))
+	for _, hook := range s.webhooks {
+		saved = append(saved, hook)
+	}
+
+	data, err := json.Marshal(saved)
+	if err == nil {
+		tmp := s.path + ".tmp"
+		if err = ioutil.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, s.path)
+		}
+	}
+
+	if err != nil {
+		raven.CaptureError(err, nil)
+		slog.Error("unable to save webhooks", "err", err)
+	}
+}
+
+func (s *webhookStore) add(hook *webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.webhooks) >= webhookMax {
+		return errTooManyWebhooks
+	}
+
+	if s.watched[hook.Address] >= webhookMaxPerAddress {
+		return errTooManyAddressWebhooks
+	}
+
+	created := 0
+	for _, existing := range s.webhooks {
+		if existing.Creator == hook.Creator {
+			created++
+		}
+	}
+
+	if created >= webhookMaxPerRequester {
+		return errTooManyRequesterWebhooks
+	}
+
+	s.webhooks[hook.ID] = hook
+	s.watched[hook.Address]++
+	s.save()
+
+	return nil
+}
+
+func (s *webhookStore) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hook, ok := s.webhooks[id]
+	if !ok {
+		return
+	}
+
+	s.forget(hook)
+	s.save()
+}
+
+// forget removes a webhook, and what is known about its server if no other
+// webhooks use it. It must be called with the lock held.
+func (s *webhookStore) forget(hook *webhook) {
+	delete(s.webhooks, hook.ID)
+
+	s.watched[hook.Address]--
+	if s.watched[hook.Address] <= 0 {
+		delete(s.watched, hook.Address)
+		delete(s.last, hook.Address)
+		delete(s.failing, hook.Address)
+	}
+}
+
+// observe records whether a server with webhooks responded to a refresh.
+func (s *webhookStore) observe(serverAddr string, status *types.ServerStatus, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.watched[serverAddr] == 0 {
+		return
+	}
+
+	if status.Error == "" {
+		delete(s.failing, serverAddr)
+	} else if _, ok := s.failing[serverAddr]; !ok {
+		s.failing[serverAddr] = now
+	}
+}
+
+// prune removes the webhooks of servers which have failed to respond for
+// longer than webhookUnreachableTTL, so they stop being refreshed.
+func (s *webhookStore) prune(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := false
+
+	for serverAddr, since := range s.failing {
+		if now.Sub(since) < webhookUnreachableTTL {
+			continue
+		}
+
+		for _, hook := range s.webhooks {
+			if hook.Address == serverAddr {
+				slog.Info("removed webhook for unreachable server", "webhook", hook.ID, "server", serverAddr)
+				s.forget(hook)
+				removed = true
+			}
+		}
+	}
+
+	if removed {
+		s.save()
+	}
+}
+
+// get returns a copy of a webhook, if the secret is correct.
+func (s *webhookStore) get(id, secret string) (webhook, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hook, ok := s.webhooks[id]
+	if !ok || !hmac.Equal([]byte(derivedWebhookSecret(id)), []byte(secret)) {
+		return webhook{}, false
+	}
+
+	copied := *hook
+	copied.Deliveries = append([]*webhookDelivery(nil), hook.Deliveries...)
+
+	return copied, true
+}
+
+// list returns copies of every webhook, without delivery logs.
+func (s *webhookStore) list() []webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hooks := make([]webhook, 0, len(s.webhooks))
+	for _, hook := range s.webhooks {
+		copied := *hook
+		copied.Deliveries = nil
+
+		hooks = append(hooks, copied)
+	}
+
+	return hooks
+}
+
+// addresses returns every server with a webhook, so they keep being
+// refreshed even if they are evicted from the cache.
+func (s *webhookStore) addresses() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := map[string]bool{}
+	var addresses []string
+
+	for _, hook := range s.webhooks {
+		if !hook.Disabled && !seen[hook.Address] {
+			seen[hook.Address] = true
+			addresses = append(addresses, hook.Address)
+		}
+	}
+
+	return addresses
+}
+
+// webhookMatch is a webhook along with the events it should be sent.
+type webhookMatch struct {
+	hook   webhook
+	events []string
+}
+
+// matching returns copies of the enabled webhooks for a server, along with
+// the events from a status change that each is interested in. Changes are
+// from the last status seen for the server, or the status before the
+// refresh if none has been seen yet.
+func (s *webhookStore) matching(event *serverEvent) []webhookMatch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.watched[event.Address] == 0 {
+		return nil
+	}
+
+	var hooks []*webhook
+	for _, hook := range s.webhooks {
+		if hook.Address == event.Address {
+			hooks = append(hooks, hook)
+		}
+	}
+
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	previous, ok := s.last[event.Address]
+	if !ok {
+		previous = event.PreviousStatus
+	}
+
+	s.last[event.Address] = event.Status
+
+	var matches []webhookMatch
+
+	for _, hook := range hooks {
+		if hook.Disabled {
+			continue
+		}
+
+		var names []string
+		for _, name := range webhookEvents(previous, event.Status, hook.PlayerThreshold) {
+			if containsString(hook.Events, name) {
+				names = append(names, name)
+			}
+		}
+
+		if len(names) > 0 {
+			copied := *hook
+			copied.Deliveries = nil
+
+			matches = append(matches, webhookMatch{hook: copied, events: names})
+		}
+	}
+
+	return matches
+}
+
+// record adds a delivery to a webhook's log, disabling the webhook once
+// too many deliveries in a row have failed.
+func (s *webhookStore) record(id string, delivery *webhookDelivery, final bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hook, ok := s.webhooks[id]
+	if !ok {
+		return
+	}
+
+	hook.Deliveries = append(hook.Deliveries, delivery)
+	if len(hook.Deliveries) > webhookLogSize {
+		hook.Deliveries = hook.Deliveries[len(hook.Deliveries)-webhookLogSize:]
+	}
+
+	if delivery.Error == "" {
+		hook.Failures = 0
+		return
+	}
+
+	if !final {
+		return
+	}
+
+	hook.Failures++
+
+	if hook.Failures >= webhookMaxFailures {
+		hook.Disabled = true
+		hook.DisabledReason = fmt.Sprintf("%d deliveries in a row failed", hook.Failures)
+
+		slog.Warn("disabled webhook", "webhook", hook.ID, "server", hook.Address)
+
+		s.save()
+	}
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// webhookEvents determines which webhook events a refresh caused.
+// A server seen for the first time causes no events.
+func webhookEvents(previous, current *types.ServerStatus, threshold int) []string {
+	if previous == nil || current == nil {
+		return nil
+	}
+
+	var names []string
+
+	if previous.Online && !current.Online {
+		names = append(names, webhookOffline)
+	} else if !previous.Online && current.Online {
+		names = append(names, webhookOnline)
+	}
+
+	if threshold > 0 {
+		if previous.Players.Now < threshold && current.Players.Now >= threshold {
+			names = append(names, webhookPlayersUp)
+		} else if previous.Players.Now >= threshold && current.Players.Now < threshold {
+			names = append(names, webhookPlayersDown)
+		}
+	}
+
+	if current.Online && previous.Online {
+		if previous.Motd != current.Motd {
+			names = append(names, webhookMotd)
+		}
+
+		if previous.Server != current.Server {
+			names = append(names, webhookVersion)
+		}
+	}
+
+	return names
+}
+
+// webhookJob is an event waiting to be delivered to a webhook.
+type webhookJob struct {
+	hook    webhook
+	id      string
+	name    string
+	body    []byte
+	attempt int
+}
+
+var (
+	webhookQueue = make(chan *webhookJob, webhookMaxPending)
+	// webhookPending holds a slot for every delivery which is queued or
+	// waiting to be retried.
+	webhookPending = make(chan struct{}, webhookMaxPending)
+)
+
+// deliverWebhooks is an event listener which queues the events each
+// webhook is interested in for delivery.
+func deliverWebhooks(event *serverEvent) {
+	if event.Kind != eventStatus {
+		return
+	}
+
+	for _, match := range webhooks.matching(event) {
+		for _, name := range match.events {
+			enqueueWebhook(match.hook, name, event.Status)
+		}
+	}
+}
+
+// enqueueWebhook queues an event for delivery, dropping it if too many
+// deliveries are already pending.
+func enqueueWebhook(hook webhook, name string, status *types.ServerStatus) {
+	deliveryID := randomHex(8)
+
+	body, err := webhookBody(hook, deliveryID, name, status)
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return
+	}
+
+	select {
+	case webhookPending <- struct{}{}:
+	default:
+		webhookDeliveries.WithLabelValues(name, "dropped").Inc()
+		slog.Warn("too many pending webhook deliveries, dropping event", "webhook", hook.ID, "event", name)
+		return
+	}
+
+	webhookQueue <- &webhookJob{hook: hook, id: deliveryID, name: name, body: body, attempt: 1}
+}
+
+// startWebhookWorkers starts the workers which deliver queued events.
+// Failed deliveries are queued again after a backoff, so a slow webhook
+// never holds a worker while it waits.
+func startWebhookWorkers() {
+	for i := 0; i < webhookWorkers; i++ {
+		go func() {
+			for job := range webhookQueue {
+				if delay, retry := attemptWebhook(job); retry {
+					retryWebhook(job, delay)
+				} else {
+					<-webhookPending
+				}
+			}
+		}()
+	}
+}
+
+func retryWebhook(job *webhookJob, delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		webhookQueue <- job
+	})
+}
+
+// webhookBody creates the body for an event in the webhook's format.
+func webhookBody(hook webhook, deliveryID, name string, status *types.ServerStatus) ([]byte, error) {
+	if hook.Format == webhookFormatDiscord {
+		return json.Marshal(discordWebhookPayload(hook.Address, name, status))
+	}
+
+	return json.Marshal(&webhookPayload{
+		ID:        deliveryID,
+		Event:     name,
+		Address:   hook.Address,
+		Timestamp: time.Now().UTC(),
+		Status:    status.V2(hook.Address),
+	})
+}
+
+// derivedWebhookSecret returns the secret of a webhook, which is an HMAC
+// of its ID keyed with webhookKey.
+func derivedWebhookSecret(id string) string {
+	mac := hmac.New(sha256.New, webhookKey)
+	mac.Write([]byte(id))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signWebhook creates the signature header value for a body.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// attemptWebhook makes one attempt at a delivery. If it failed and has
+// attempts left, it returns how long to wait before retrying, which
+// doubles after each failure.
+func attemptWebhook(job *webhookJob) (time.Duration, bool) {
+	delivery := &webhookDelivery{
+		ID:      job.id,
+		Event:   job.name,
+		Attempt: job.attempt,
+		Time:    time.Now().UTC(),
+	}
+
+	code, err := postWebhook(job.hook, job.id, job.name, job.body)
+
+	delivery.StatusCode = code
+	delivery.DurationMs = float64(time.Since(delivery.Time)) / float64(time.Millisecond)
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+
+	final := err == nil || job.attempt == webhookAttempts
+	webhooks.record(job.hook.ID, delivery, final)
+
+	if err == nil {
+		webhookDeliveries.WithLabelValues(job.name, "delivered").Inc()
+		return 0, false
+	}
+
+	slog.Warn("webhook delivery failed", "webhook", job.hook.ID, "delivery", job.id, "attempt", job.attempt, "err", err)
+
+	if final {
+		webhookDeliveries.WithLabelValues(job.name, "failed").Inc()
+		return 0, false
+	}
+
+	webhookDeliveries.WithLabelValues(job.name, "retried").Inc()
+
+	delay := webhookBackoff << uint(job.attempt-1)
+	job.attempt++
+
+	return delay, true
+}
+
+func postWebhook(hook webhook, deliveryID, name string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mcapi-webhooks")
+	req.Header.Set("X-Mcapi-Event", name)
+	req.Header.Set("X-Mcapi-Delivery", deliveryID)
+	req.Header.Set("X-Mcapi-Signature", signWebhook(derivedWebhookSecret(hook.ID), body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// discordWebhookPayload creates a Discord webhook message for an event.
+func discordWebhookPayload(address, name string, status *types.ServerStatus) gin.H {
+	titles := map[string]string{
+		webhookOffline:     "%s went offline",
+		webhookOnline:      "%s came online",
+		webhookPlayersUp:   "%s player count went up",
+		webhookPlayersDown: "%s player count went down",
+		webhookMotd:        "%s changed its MOTD",
+		webhookVersion:     "%s changed its version",
+	}
+
+	color := 0x6AFF42
+	if !status.Online {
+		color = 0xE74C3C
+	}
+
+	return gin.H{
+		"username": "mcapi",
+		"embeds": []gin.H{{
+			"title":       fmt.Sprintf(titles[name], address),
+			"description": status.Motd,
+			"color":       color,
+			"timestamp":   time.Now().UTC().Format(time.RFC3339),
+			"fields": []gin.H{
+				{
+					"name":   "Players",
+					"value":  fmt.Sprintf("%d/%d", status.Players.Now, status.Players.Max),
+					"inline": true,
+				},
+				{
+					"name":   "Version",
+					"value":  orDash(status.Server.Name),
+					"inline": true,
+				},
+			},
+		}},
+	}
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
+
+// newWebhook validates a registration request.
+func newWebhook(req *webhookRequest) (*webhook, error) {
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, errors.New("url must be an absolute http or https URL")
+	}
+
+	serverAddr, err := parseAddress(req.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(req.Events) == 0 {
+		return nil, errors.New("at least one event is required")
+	}
+
+	for _, name := range req.Events {
+		if !containsString(webhookEventNames, name) {
+			return nil, fmt.Errorf("unknown event %s, must be one of %s", name, strings.Join(webhookEventNames, ", "))
+		}
+
+		if (name == webhookPlayersUp || name == webhookPlayersDown) && req.PlayerThreshold <= 0 {
+			return nil, errors.New("player_threshold is required for player events")
+		}
+	}
+
+	format := req.Format
+	if format == "" {
+		format = webhookFormatDefault
+	} else if format != webhookFormatDefault && format != webhookFormatDiscord {
+		return nil, errors.New("format must be default or discord")
+	}
+
+	return &webhook{
+		ID:              randomHex(8),
+		URL:             target.String(),
+		Address:         serverAddr,
+		Events:          req.Events,
+		PlayerThreshold: req.PlayerThreshold,
+		Format:          format,
+		Created:         time.Now().UTC(),
+	}, nil
+}
+
+func webhookSecret(c *gin.Context) string {
+	return strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+}
+
+func respondCreateWebhook(c *gin.Context) {
+	ip := requester(c)
+
+	if limit, count := shouldRateLimit(c.Request.Context(), ip); limit {
+		abortLookup(c, rateLimitedError(count))
+		return
+	}
+
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		render(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hook, err := newWebhook(&req)
+	if err != nil {
+		incrRateLimit(ip)
+		render(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hook.Creator = hashAPIKey(ip)
+
+	// Make sure the server exists and starts being refreshed.
+	if _, lookupErr := lookupStatus(c.Request.Context(), hook.Address, ip); lookupErr != nil {
+		abortLookup(c, lookupErr)
+		return
+	}
+
+	// The secret is only included in the response, never saved.
+	created := *hook
+	created.Secret = derivedWebhookSecret(hook.ID)
+
+	if err := webhooks.add(hook); err == errTooManyWebhooks {
+		render(c, http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		render(c, http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger(c.Request.Context()).Info("created webhook", "webhook", hook.ID, "server", hook.Address, "requester", ip)
+
+	render(c, http.StatusCreated, &created)
+}
+
+func respondWebhook(c *gin.Context) {
+	hook, ok := webhooks.get(c.Param("id"), webhookSecret(c))
+	if !ok {
+		render(c, http.StatusNotFound, gin.H{"error": "unknown webhook"})
+		return
+	}
+
+	render(c, http.StatusOK, hook)
+}
+
+func respondDeleteWebhook(c *gin.Context) {
+	if _, ok := webhooks.get(c.Param("id"), webhookSecret(c)); !ok {
+		render(c, http.StatusNotFound, gin.H{"error": "unknown webhook"})
+		return
+	}
+
+	webhooks.remove(c.Param("id"))
+
+	c.Status(http.StatusNoContent)
+}
+
+func respondAdminWebhooks(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks": webhooks.list(),
+	})
+}
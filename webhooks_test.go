@@ -0,0 +1,365 @@
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/syfaro/mcapi/types"
+)
+
+func TestWebhookTransitionsAfterEviction(t *testing.T) {
+	store := newWebhookStore()
+	store.add(&webhook{
+		ID:      "hook",
+		Address: "example.com:25565",
+		Events:  []string{webhookOnline, webhookOffline},
+	})
+
+	online := &types.ServerStatus{Online: true}
+	offline := &types.ServerStatus{Online: false}
+
+	if matches := store.matching(&serverEvent{Kind: eventStatus, Address: "example.com:25565", Status: online}); len(matches) != 0 {
+		t.Errorf("expected no events for a server seen for the first time, got %v", matches)
+	}
+
+	// The server was evicted and cached again, so the event has no previous
+	// status.
+	matches := store.matching(&serverEvent{Kind: eventStatus, Address: "example.com:25565", Status: offline})
+	if len(matches) != 1 || len(matches[0].events) != 1 || matches[0].events[0] != webhookOffline {
+		t.Fatalf("expected the server going offline to be sent, got %v", matches)
+	}
+
+	if matches := store.matching(&serverEvent{Kind: eventStatus, Address: "other.example.com:25565", Status: online}); len(matches) != 0 {
+		t.Errorf("expected no events for other servers, got %v", matches)
+	}
+
+	if _, ok := store.last["other.example.com:25565"]; ok {
+		t.Error("expected servers without webhooks not to be remembered")
+	}
+
+	store.remove("hook")
+
+	if _, ok := store.last["example.com:25565"]; ok {
+		t.Error("expected the server to be forgotten once its webhooks are removed")
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"event":"online"}`)
+
+	signature := signWebhook("secret", body)
+	if !hmac.Equal([]byte(signature), []byte(signWebhook("secret", body))) {
+		t.Error("expected signatures to be stable")
+	}
+
+	if signature[:7] != "sha256=" || len(signature) != 7+64 {
+		t.Errorf("unexpected signature %s", signature)
+	}
+
+	if signature == signWebhook("other", body) || signature == signWebhook("secret", []byte(`{}`)) {
+		t.Error("expected the signature to depend on the secret and body")
+	}
+}
+
+// webhookServer records deliveries, failing the first failures requests.
+func webhookServer(t *testing.T, failures int) (*httptest.Server, func() []*http.Request, func() [][]byte) {
+	var mu sync.Mutex
+	var requests []*http.Request
+	var bodies [][]byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+
+		if len(requests) <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+
+	previous := webhookClient
+	webhookClient = server.Client()
+	t.Cleanup(func() {
+		webhookClient = previous
+		server.Close()
+	})
+
+	return server, func() []*http.Request {
+			mu.Lock()
+			defer mu.Unlock()
+			return requests
+		}, func() [][]byte {
+			mu.Lock()
+			defer mu.Unlock()
+			return bodies
+		}
+}
+
+func testWebhookStore(hook *webhook) func() {
+	previous := webhooks
+	webhooks = newWebhookStore()
+	webhooks.add(hook)
+
+	return func() { webhooks = previous }
+}
+
+// queuedWebhook takes the next delivery from the queue, releasing its slot
+// as a worker would once it is finished with.
+func queuedWebhook(t *testing.T) *webhookJob {
+	select {
+	case job := <-webhookQueue:
+		t.Cleanup(func() { <-webhookPending })
+		return job
+	case <-time.After(time.Second):
+		t.Fatal("expected a delivery to be queued")
+		return nil
+	}
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	server, requests, bodies := webhookServer(t, 0)
+
+	hook := &webhook{ID: "hook", URL: server.URL, Address: "example.com:25565"}
+	defer testWebhookStore(hook)()
+
+	enqueueWebhook(*hook, webhookOnline, &types.ServerStatus{Online: true, LastUpdated: "0"})
+
+	if _, retry := attemptWebhook(queuedWebhook(t)); retry {
+		t.Error("expected a successful delivery not to be retried")
+	}
+
+	if len(requests()) != 1 {
+		t.Fatalf("expected one delivery, got %d", len(requests()))
+	}
+
+	req, body := requests()[0], bodies()[0]
+
+	if req.Header.Get("X-Mcapi-Event") != webhookOnline || req.Header.Get("X-Mcapi-Signature") != signWebhook(derivedWebhookSecret("hook"), body) {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.Event != webhookOnline || payload.Address != "example.com:25565" || payload.ID != req.Header.Get("X-Mcapi-Delivery") {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+
+	if len(hook.Deliveries) != 1 || hook.Deliveries[0].StatusCode != http.StatusOK || hook.Failures != 0 {
+		t.Errorf("expected the delivery to be recorded, got %+v", hook.Deliveries)
+	}
+}
+
+func TestDeliverWebhookRetry(t *testing.T) {
+	server, requests, _ := webhookServer(t, 1)
+
+	hook := &webhook{ID: "hook", URL: server.URL, Address: "example.com:25565"}
+	defer testWebhookStore(hook)()
+
+	enqueueWebhook(*hook, webhookOffline, &types.ServerStatus{LastUpdated: "0"})
+	job := queuedWebhook(t)
+
+	delay, retry := attemptWebhook(job)
+	if !retry || delay != webhookBackoff || job.attempt != 2 {
+		t.Fatalf("expected the failed delivery to be retried after %s, got %s", webhookBackoff, delay)
+	}
+
+	if _, retry := attemptWebhook(job); retry {
+		t.Error("expected the retry to succeed")
+	}
+
+	if len(requests()) != 2 {
+		t.Fatalf("expected the failed delivery to be retried, got %d requests", len(requests()))
+	}
+
+	if len(hook.Deliveries) != 2 || hook.Deliveries[0].StatusCode != http.StatusInternalServerError || hook.Deliveries[1].Attempt != 2 {
+		t.Errorf("expected both attempts to be recorded, got %+v", hook.Deliveries)
+	}
+
+	if hook.Failures != 0 {
+		t.Errorf("expected a successful retry not to count as a failure, got %d", hook.Failures)
+	}
+}
+
+func TestWebhookQueueFull(t *testing.T) {
+	for i := 0; i < webhookMaxPending; i++ {
+		webhookPending <- struct{}{}
+	}
+
+	defer func() {
+		for i := 0; i < webhookMaxPending; i++ {
+			<-webhookPending
+		}
+	}()
+
+	enqueueWebhook(webhook{ID: "hook"}, webhookOnline, &types.ServerStatus{LastUpdated: "0"})
+
+	if len(webhookQueue) != 0 {
+		t.Error("expected the event to be dropped while too many deliveries are pending")
+	}
+}
+
+func TestWebhookSecretNotSaved(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	previous := webhooks
+	webhooks = newWebhookStore()
+	webhooks.path = filepath.Join(t.TempDir(), "webhooks.json")
+	defer func() { webhooks = previous }()
+
+	router := fieldsRouter()
+	router.POST("/webhooks", respondCreateWebhook)
+	router.GET("/webhooks/:id", respondWebhook)
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(
+		`{"url": "https://example.com/hook", "address": "example.com", "events": ["offline"]}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var created webhook
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+
+	if created.Secret == "" || created.Secret != derivedWebhookSecret(created.ID) {
+		t.Errorf("expected the derived secret to be returned, got %q", created.Secret)
+	}
+
+	saved, err := ioutil.ReadFile(webhooks.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(saved), created.Secret) || webhooks.webhooks[created.ID].Secret != "" {
+		t.Error("expected the secret not to be kept")
+	}
+
+	for secret, code := range map[string]int{created.Secret: http.StatusOK, "wrong": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, "/webhooks/"+created.ID, nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != code {
+			t.Errorf("expected %d with secret %q, got %d", code, secret, w.Code)
+		}
+	}
+}
+
+func TestWebhookDisabledAfterFailures(t *testing.T) {
+	hook := &webhook{ID: "hook"}
+	defer testWebhookStore(hook)()
+
+	for i := 0; i < webhookMaxFailures; i++ {
+		webhooks.record("hook", &webhookDelivery{Attempt: 1, Error: "refused"}, false)
+
+		if hook.Failures != i {
+			t.Fatalf("expected retries not to count as failures, got %d", hook.Failures)
+		}
+
+		webhooks.record("hook", &webhookDelivery{Attempt: webhookAttempts, Error: "refused"}, true)
+	}
+
+	if !hook.Disabled || hook.DisabledReason == "" {
+		t.Error("expected the webhook to be disabled")
+	}
+
+	for i := 0; i < webhookLogSize; i++ {
+		webhooks.record("hook", &webhookDelivery{Attempt: 1}, true)
+	}
+
+	if len(hook.Deliveries) != webhookLogSize {
+		t.Errorf("expected the log to be limited to %d deliveries, got %d", webhookLogSize, len(hook.Deliveries))
+	}
+}
+
+func TestWebhookLimits(t *testing.T) {
+	store := newWebhookStore()
+
+	for i := 0; i < webhookMaxPerAddress; i++ {
+		hook := &webhook{ID: randomHex(8), Address: "example.com:25565", Creator: randomHex(8)}
+		if err := store.add(hook); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.add(&webhook{ID: "one", Address: "example.com:25565"}); err != errTooManyAddressWebhooks {
+		t.Errorf("expected too many webhooks for the server, got %v", err)
+	}
+
+	for i := 0; i < webhookMaxPerRequester; i++ {
+		hook := &webhook{ID: randomHex(8), Address: randomHex(4) + ".example.com:25565", Creator: "caller"}
+		if err := store.add(hook); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.add(&webhook{ID: "two", Address: "other.example.com:25565", Creator: "caller"}); err != errTooManyRequesterWebhooks {
+		t.Errorf("expected too many webhooks for the caller, got %v", err)
+	}
+
+	previous := webhookMax
+	webhookMax = len(store.webhooks)
+	defer func() { webhookMax = previous }()
+
+	if err := store.add(&webhook{ID: "three", Address: "other.example.com:25565", Creator: "other"}); err != errTooManyWebhooks {
+		t.Errorf("expected too many webhooks in total, got %v", err)
+	}
+}
+
+func TestWebhookPruneUnreachable(t *testing.T) {
+	store := newWebhookStore()
+	store.add(&webhook{ID: "down", Address: "down.example.com:25565"})
+	store.add(&webhook{ID: "flaky", Address: "flaky.example.com:25565"})
+
+	now := time.Now()
+	failed := &types.ServerStatus{Status: "error", Error: "connection refused"}
+
+	store.observe("down.example.com:25565", failed, now)
+	store.observe("flaky.example.com:25565", failed, now)
+	store.observe("unwatched.example.com:25565", failed, now)
+
+	store.observe("down.example.com:25565", failed, now.Add(time.Hour))
+	store.observe("flaky.example.com:25565", &types.ServerStatus{Online: true}, now.Add(time.Hour))
+
+	if _, ok := store.failing["unwatched.example.com:25565"]; ok {
+		t.Error("expected servers without webhooks not to be tracked")
+	}
+
+	store.prune(now.Add(webhookUnreachableTTL - time.Minute))
+	if len(store.webhooks) != 2 {
+		t.Fatalf("expected webhooks to be kept until the server was unreachable long enough, got %d", len(store.webhooks))
+	}
+
+	store.prune(now.Add(webhookUnreachableTTL))
+
+	if _, ok := store.webhooks["down"]; ok {
+		t.Error("expected the webhook for the unreachable server to be removed")
+	}
+
+	if _, ok := store.webhooks["flaky"]; !ok {
+		t.Error("expected the webhook for the server which responded to be kept")
+	}
+
+	if addresses := store.addresses(); len(addresses) != 1 || addresses[0] != "flaky.example.com:25565" {
+		t.Errorf("expected only the reachable server to be refreshed, got %v", addresses)
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/syfaro/mcapi/types"
+)
+
+const (
+	defaultWebSocketMaxPerIP = 5
+
+	// wsWriteWait is how long a client has to accept a message before it is
+	// considered to have stopped reading and is disconnected.
+	wsWriteWait = 10 * time.Second
+	// wsPongWait is how long to wait for a pong, and wsPingPeriod how often
+	// pings are sent. Pings must be sent more often than pongs are required.
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = 30 * time.Second
+	// wsBuffer is how many messages may be waiting to be sent to a client.
+	wsBuffer = 64
+	// wsMaxMessage is the largest message accepted from a client.
+	wsMaxMessage = 4096
+)
+
+// webSocketMaxPerIP is the most connections allowed from one IP address.
+var webSocketMaxPerIP = defaultWebSocketMaxPerIP
+
+var wsConnections = map[string]int{}
+var wsConnectionsMu sync.Mutex
+
+var wsUpgrader = websocket.Upgrader{
+	// Any site may use the API, as with CORS on every other endpoint.
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// wsRequest is a message sent by a client. Type is one of subscribe,
+// unsubscribe or refresh. Kind is status or query, for refreshes.
+type wsRequest struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+	Kind    string `json:"kind"`
+}
+
+// wsMessage is a message sent to a client. Status and query messages
+// include only the fields which have changed since the last one sent for
+// that server, or every field for the first.
+type wsMessage struct {
+	Type    string                     `json:"type"`
+	Address string                     `json:"address,omitempty"`
+	Changes []string                   `json:"changes,omitempty"`
+	Delta   map[string]json.RawMessage `json:"delta,omitempty"`
+	Error   string                     `json:"error,omitempty"`
+}
+
+type wsClient struct {
+	conn *websocket.Conn
+	// caller identifies the client for rate limiting, like requester.
+	caller string
+	// trusted is set for clients with an API key, and owner is the owner
+	// token they sent, which both allow more frequent refreshes.
+	trusted bool
+	owner   string
+	sub     *subscription
+
+	// send holds messages and snapshot events for the writer.
+	send chan interface{}
+	done chan struct{}
+	once sync.Once
+
+	// sent is the last state sent for each kind and server. It is only
+	// used by the writer.
+	sent map[string]map[string]json.RawMessage
+}
+
+// wsForget tells the writer a server was unsubscribed from.
+type wsForget struct {
+	address string
+}
+
+func acquireWebSocket(ip string) bool {
+	wsConnectionsMu.Lock()
+	defer wsConnectionsMu.Unlock()
+
+	if wsConnections[ip] >= webSocketMaxPerIP {
+		return false
+	}
+
+	wsConnections[ip]++
+
+	return true
+}
+
+func releaseWebSocket(ip string) {
+	wsConnectionsMu.Lock()
+	defer wsConnectionsMu.Unlock()
+
+	wsConnections[ip]--
+	if wsConnections[ip] <= 0 {
+		delete(wsConnections, ip)
+	}
+}
+
+func respondWebSocket(c *gin.Context) {
+	// Connections are limited by address even with an API key, as every
+	// connection holds resources for as long as it is open.
+	ip := c.ClientIP()
+
+	if !acquireWebSocket(ip) {
+		render(c, http.StatusTooManyRequests, gin.H{
+			"error": "too many connections",
+		})
+		return
+	}
+	defer releaseWebSocket(ip)
+
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+
+	client := &wsClient{
+		conn:    conn,
+		caller:  requester(c),
+		trusted: c.GetString(apiKeyContext) != "",
+		owner:   c.GetHeader(ownerHeader),
+		sub:     events.subscribe(wsBuffer),
+		send:    make(chan interface{}, wsBuffer),
+		done:    make(chan struct{}),
+		sent:    map[string]map[string]json.RawMessage{},
+	}
+	defer client.close()
+
+	go client.writer()
+
+	client.reader()
+}
+
+func (cl *wsClient) close() {
+	cl.once.Do(func() {
+		close(cl.done)
+		cl.sub.close()
+		cl.conn.Close()
+	})
+}
+
+// queue passes something to the writer, disconnecting the client if it
+// has too much waiting already.
+func (cl *wsClient) queue(v interface{}) {
+	select {
+	case cl.send <- v:
+	case <-cl.done:
+	default:
+		cl.close()
+	}
+}
+
+func (cl *wsClient) reader() {
+	cl.conn.SetReadLimit(wsMaxMessage)
+	cl.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	cl.conn.SetPongHandler(func(string) error {
+		return cl.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		var req wsRequest
+		if err := cl.conn.ReadJSON(&req); err != nil {
+			return
+		}
+
+		serverAddr, err := parseAddress(req.Address)
+		if err != nil {
+			cl.queue(&wsMessage{Type: "error", Address: req.Address, Error: err.Error()})
+			continue
+		}
+
+		switch req.Type {
+		case "subscribe":
+			cl.subscribe(serverAddr)
+		case "unsubscribe":
+			cl.sub.remove(serverAddr)
+			cl.queue(wsForget{address: serverAddr})
+		case "refresh":
+			cl.refresh(serverAddr, req.Kind)
+		default:
+			cl.queue(&wsMessage{Type: "error", Address: req.Address, Error: "unknown message type"})
+		}
+	}
+}
+
+// subscribe starts following a server and sends its current state.
+func (cl *wsClient) subscribe(serverAddr string) {
+	if cl.sub.count() >= batchMaxAddresses {
+		cl.queue(&wsMessage{Type: "error", Address: serverAddr, Error: "too many subscriptions"})
+		return
+	}
+
+	cl.sub.add(serverAddr)
+
+	status, err := lookupStatus(context.Background(), serverAddr, cl.caller)
+	if err != nil {
+		cl.queue(&wsMessage{Type: "error", Address: serverAddr, Error: err.Message})
+		return
+	}
+
+	cl.queue(&serverEvent{Kind: eventStatus, Address: serverAddr, Status: status})
+
+	if query, ok := queryMap.GetOK(serverAddr); ok {
+		cl.queue(&serverEvent{Kind: eventQuery, Address: serverAddr, Query: query.(*types.ServerQuery)})
+	}
+}
+
+// refresh immediately pings or queries a server. Any changes are sent to
+// subscribers as usual. Refreshes are limited in the same way as over HTTP.
+func (cl *wsClient) refresh(serverAddr, kind string) {
+	ctx := context.Background()
+	trusted := cl.trusted || owners.owns(cl.owner, serverAddr, time.Now())
+
+	var err *lookupError
+	if kind == eventQuery {
+		_, err = refreshQuery(ctx, serverAddr, cl.caller, trusted)
+	} else {
+		_, err = refreshStatus(ctx, serverAddr, cl.caller, trusted)
+	}
+
+	if err != nil {
+		cl.queue(&wsMessage{Type: "error", Address: serverAddr, Error: err.Message})
+		return
+	}
+
+	cl.queue(&wsMessage{Type: "refreshed", Address: serverAddr})
+}
+
+func (cl *wsClient) writer() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	defer cl.close()
+
+	for {
+		var msg interface{}
+
+		select {
+		case event, ok := <-cl.sub.events:
+			if !ok {
+				return
+			}
+
+			delta := cl.delta(event)
+			if delta == nil {
+				continue
+			}
+
+			msg = delta
+		case v := <-cl.send:
+			switch item := v.(type) {
+			case *serverEvent:
+				delta := cl.delta(item)
+				if delta == nil {
+					continue
+				}
+
+				msg = delta
+			case wsForget:
+				delete(cl.sent, eventStatus+" "+item.address)
+				delete(cl.sent, eventQuery+" "+item.address)
+
+				msg = &wsMessage{Type: "unsubscribed", Address: item.address}
+			default:
+				msg = item
+			}
+		case <-ticker.C:
+			cl.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := cl.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+
+			continue
+		case <-cl.done:
+			return
+		}
+
+		cl.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := cl.conn.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+}
+
+// delta creates a message with the fields of an event which have changed
+// since the last one sent for that server. It returns nil if nothing changed.
+func (cl *wsClient) delta(event *serverEvent) *wsMessage {
+	var value interface{} = event.Status
+	if event.Kind == eventQuery {
+		value = event.Query
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		slog.Error("unable to encode event", "kind", event.Kind, "server", event.Address, "err", err)
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+
+	key := event.Kind + " " + event.Address
+	previous := cl.sent[key]
+
+	delta := map[string]json.RawMessage{}
+
+	for k, v := range fields {
+		if !bytes.Equal(previous[k], v) {
+			delta[k] = v
+		}
+	}
+
+	for k := range previous {
+		if _, ok := fields[k]; !ok {
+			delta[k] = json.RawMessage("null")
+		}
+	}
+
+	cl.sent[key] = fields
+
+	if len(delta) == 0 {
+		return nil
+	}
+
+	return &wsMessage{
+		Type:    event.Kind,
+		Address: event.Address,
+		Changes: event.Changes,
+		Delta:   delta,
+	}
+}
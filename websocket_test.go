@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/syfaro/mcapi/types"
+)
+
+func dialWebSocket(server *httptest.Server) (*websocket.Conn, *http.Response, error) {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	return websocket.DefaultDialer.Dial(url, nil)
+}
+
+func readWebSocket(t *testing.T, conn *websocket.Conn) *wsMessage {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var msg wsMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+
+	return &msg
+}
+
+func TestWebSocketDeltas(t *testing.T) {
+	router := fieldsRouter()
+	queryMap = newServerCache(0, 0)
+	router.GET("/ws", respondWebSocket)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn, _, err := dialWebSocket(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(&wsRequest{Type: "subscribe", Address: "Example.com"})
+
+	msg := readWebSocket(t, conn)
+	if msg.Type != eventStatus || msg.Address != "example.com:25565" || msg.Delta["motd"] == nil {
+		t.Fatalf("expected the full current status, got %+v", msg)
+	}
+
+	waitForSubscribers(t, "example.com:25565", 1)
+
+	cached, _ := pingMap.GetOK("example.com:25565")
+	unchanged := *cached.(*types.ServerStatus)
+
+	// Nothing changed since the snapshot, so nothing should be sent.
+	events.publish(&serverEvent{Kind: eventStatus, Address: "example.com:25565", Changes: []string{"players"}, Status: &unchanged})
+
+	status := unchanged
+	status.Players.Now = 4
+
+	events.publish(&serverEvent{Kind: eventStatus, Address: "example.com:25565", Changes: []string{"players"}, Status: &status})
+
+	msg = readWebSocket(t, conn)
+	if msg.Type != eventStatus || len(msg.Delta) != 1 || string(msg.Delta["players"]) != `{"max":20,"now":4}` {
+		t.Errorf("expected only the players to be sent, got %+v", msg)
+	}
+
+	conn.WriteJSON(&wsRequest{Type: "subscribe", Address: "example.com:notaport"})
+
+	if msg := readWebSocket(t, conn); msg.Type != "error" {
+		t.Errorf("expected an invalid address to be an error, got %+v", msg)
+	}
+}
+
+func TestWebSocketLimit(t *testing.T) {
+	previous := webSocketMaxPerIP
+	webSocketMaxPerIP = 1
+	defer func() { webSocketMaxPerIP = previous }()
+
+	router := fieldsRouter()
+	router.GET("/ws", respondWebSocket)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	first, _, err := dialWebSocket(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, resp, err := dialWebSocket(server)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected a second connection to be refused, got %v", err)
+	}
+
+	first.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, _, err := dialWebSocket(server)
+		if err == nil {
+			conn.Close()
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("expected closing a connection to free its slot")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebSocketRefreshLimited(t *testing.T) {
+	router := fieldsRouter()
+	queryMap = newServerCache(0, 0)
+	router.GET("/ws", respondWebSocket)
+
+	previous := refreshes
+	refreshes = &refreshLimiter{
+		targets: map[string]time.Time{},
+		callers: map[string]*tokenBucket{},
+	}
+	defer func() { refreshes = previous }()
+
+	serverAddr := fakeStatusServer(t, statusPacket(capturedStatus))
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn, _, err := dialWebSocket(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(&wsRequest{Type: "refresh", Address: serverAddr, Kind: eventStatus})
+
+	if msg := readWebSocket(t, conn); msg.Type != "refreshed" {
+		t.Fatalf("expected the server to be refreshed, got %+v", msg)
+	}
+
+	conn.WriteJSON(&wsRequest{Type: "refresh", Address: serverAddr, Kind: eventStatus})
+
+	if msg := readWebSocket(t, conn); msg.Type != "error" || msg.Error != "server was refreshed too recently" {
+		t.Errorf("expected the second refresh to be refused, got %+v", msg)
+	}
+}